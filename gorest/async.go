@@ -0,0 +1,174 @@
+package bunker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// Future is a Do running in its own goroutine. The requester must not be used
+// until the future is done.
+type Future struct {
+	req    *Requester
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// DoAsync starts Do and returns at once. The request context is derived from
+// the one given to SetContext so Cancel can abort it. The context is released
+// when the response body is closed, or at once when Do gets no response.
+func (base *Requester) DoAsync() *Future {
+	parent := base.Context
+	ctx := parent
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	future := &Future{req: base, cancel: cancel, done: make(chan struct{})}
+	base.Context = ctx
+	go func() {
+		defer close(future.done)
+		base.Do()
+		if base.Response == nil || base.Response.Body == nil {
+			cancel()
+		} else {
+			base.Response.Body = &cancelBody{ReadCloser: base.Response.Body, cancel: cancel}
+		}
+		base.Context = parent
+	}()
+	return future
+}
+
+func (future *Future) Done() <-chan struct{} {
+	return future.done
+}
+
+// Cancel aborts the request, closing the response body also releases its
+// context.
+func (future *Future) Cancel() {
+	future.cancel()
+}
+
+// Wait returns the requester and its errors once Do is done, or the error of
+// ctx when it is done first. The request keeps running in that case.
+func (future *Future) Wait(ctx context.Context) (*Requester, error) {
+	select {
+	case <-future.done:
+		return future.req, future.req.Err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// WaitAll waits for every future and returns their requesters in order, the
+// error wraps the error of every failed one. The caller closes every response
+// body as usual. When ctx is done first every future is cancelled.
+func WaitAll(ctx context.Context, futures ...*Future) ([]*Requester, error) {
+	requesters := make([]*Requester, len(futures))
+	var errs []error
+	for i, future := range futures {
+		req, err := future.Wait(ctx)
+		if req == nil {
+			for _, future := range futures {
+				future.Cancel()
+			}
+			return nil, err
+		}
+		requesters[i] = req
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return requesters, &RequestError{Errors: errs}
+	}
+	return requesters, nil
+}
+
+// WaitFirst returns the first requester without errors and with a 2xx
+// status, the other futures are cancelled and their response bodies closed.
+// When none succeeds every body is closed and the error wraps the error of
+// every future, a StatusError for a response of another status.
+func WaitFirst(ctx context.Context, futures ...*Future) (*Requester, error) {
+	if len(futures) == 0 {
+		return nil, errors.New("no future to wait for")
+	}
+	finished := make(chan *Future, len(futures))
+	for _, future := range futures {
+		go func(future *Future) {
+			select {
+			case <-future.done:
+				finished <- future
+			case <-ctx.Done():
+			}
+		}(future)
+	}
+	cancelOthers := func(winner *Future) {
+		for _, future := range futures {
+			if future != winner {
+				future.discard()
+			}
+		}
+	}
+
+	var errs []error
+	for range futures {
+		select {
+		case future := <-finished:
+			if err := future.result(); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			cancelOthers(future)
+			return future.req, nil
+		case <-ctx.Done():
+			cancelOthers(nil)
+			return nil, ctx.Err()
+		}
+	}
+	cancelOthers(nil)
+	return nil, &RequestError{Errors: errs}
+}
+
+// discard cancels the future and closes its response body once it is done.
+func (future *Future) discard() {
+	future.Cancel()
+	select {
+	case <-future.done:
+		future.closeBody()
+	default:
+		go func() {
+			<-future.done
+			future.closeBody()
+		}()
+	}
+}
+
+func (future *Future) closeBody() {
+	if response := future.req.Response; response != nil && response.Body != nil {
+		response.Body.Close()
+	}
+}
+
+// cancelBody releases the context of a future with its response body.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *cancelBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
+
+func (future *Future) result() error {
+	if err := future.req.Err(); err != nil {
+		return err
+	}
+	if response := future.req.Response; response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return &StatusError{StatusCode: response.StatusCode, Status: response.Status}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package bunker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDoAsync(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = io.WriteString(w, r.URL.Path)
+	}))
+	defer server.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	t.Run("testWait", func(t *testing.T) {
+		future := New(server.URL).AddPath("fast").Get().DoAsync()
+		req, err := future.Wait(context.Background())
+		if err != nil || req.Response.StatusCode != http.StatusOK {
+			t.Fatalf("invalid result %v", err)
+		}
+		select {
+		case <-future.Done():
+		default:
+			t.Errorf("future must be done after Wait")
+		}
+		if req.Context != nil {
+			t.Errorf("requester context must be restored")
+		}
+	})
+
+	t.Run("testCancel", func(t *testing.T) {
+		future := New(server.URL).AddPath("slow").Get().DoAsync()
+		future.Cancel()
+		if _, err := future.Wait(context.Background()); !errors.Is(err, context.Canceled) {
+			t.Errorf("invalid error\n\tExpected : %v\n\tActual : %v", context.Canceled, err)
+		}
+	})
+
+	t.Run("testWaitContext", func(t *testing.T) {
+		future := New(server.URL).AddPath("slow").Get().DoAsync()
+		defer future.Cancel()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if req, err := future.Wait(ctx); req != nil || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("invalid error\n\tExpected : %v\n\tActual : %v", context.DeadlineExceeded, err)
+		}
+	})
+
+	t.Run("testWaitAll", func(t *testing.T) {
+		requesters, err := WaitAll(context.Background(),
+			New(server.URL).AddPath("first").Get().DoAsync(),
+			New(dead.URL).Get().DoAsync(),
+			New(server.URL).AddPath("second").Get().DoAsync(),
+		)
+		var requestErr *RequestError
+		if !errors.As(err, &requestErr) || len(requestErr.Errors) != 1 {
+			t.Errorf("error must wrap the failed future, got %v", err)
+		}
+		if len(requesters) != 3 || requesters[0].Response == nil || requesters[1].Response != nil || requesters[2].Response == nil {
+			t.Errorf("requesters must be returned in order")
+		}
+	})
+
+	t.Run("testWaitFirst", func(t *testing.T) {
+		slow := New(server.URL).AddPath("slow").Get().DoAsync()
+		req, err := WaitFirst(context.Background(),
+			slow,
+			New(server.URL).AddPath("broken").Get().DoAsync(),
+			New(server.URL).AddPath("fast").Get().DoAsync(),
+		)
+		if err != nil || req.Request.URL.Path != "/fast" {
+			t.Fatalf("invalid winner %v", err)
+		}
+		if _, err := slow.Wait(context.Background()); !errors.Is(err, context.Canceled) {
+			t.Errorf("other futures must be cancelled, got %v", err)
+		}
+	})
+
+	t.Run("testWaitAllReleasedByClose", func(t *testing.T) {
+		requesters, err := WaitAll(context.Background(),
+			New(server.URL).AddPath("first").Get().DoAsync(),
+			New(server.URL).AddPath("second").Get().DoAsync(),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, req := range requesters {
+			ctx := req.Response.Request.Context()
+			if ctx.Err() != nil {
+				t.Fatalf("context must live until the body is closed")
+			}
+			data, _ := io.ReadAll(req.Response.Body)
+			req.Response.Body.Close()
+			if string(data) != req.Request.URL.Path || !errors.Is(ctx.Err(), context.Canceled) {
+				t.Errorf("closing the body must release the context, got %q %v", data, ctx.Err())
+			}
+		}
+	})
+
+	t.Run("testWaitFirstClosesLosers", func(t *testing.T) {
+		broken := New(server.URL).AddPath("broken").Get().DoAsync()
+		_, _ = broken.Wait(context.Background())
+		if _, err := WaitFirst(context.Background(), broken, New(server.URL).AddPath("fast").Get().DoAsync()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(broken.req.Response.Body); err == nil {
+			t.Errorf("body of a finished loser must be closed")
+		}
+	})
+
+	t.Run("testReleasedWithoutResponse", func(t *testing.T) {
+		future := New(dead.URL).Get().DoAsync()
+		_, _ = future.Wait(context.Background())
+		if err := future.req.Request.Context().Err(); !errors.Is(err, context.Canceled) {
+			t.Errorf("invalid context error\n\tExpected : %v\n\tActual : %v", context.Canceled, err)
+		}
+	})
+
+	t.Run("testWaitFirstAllFail", func(t *testing.T) {
+		_, err := WaitFirst(context.Background(),
+			New(server.URL).AddPath("broken").Get().DoAsync(),
+			New(dead.URL).Get().DoAsync(),
+		)
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+			t.Errorf("error must wrap every failure, got %v", err)
+		}
+	})
+}
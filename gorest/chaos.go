@@ -0,0 +1,338 @@
+package bunker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// LatencyDistribution draws the delay a ChaosTransport adds to a request.
+type LatencyDistribution interface {
+	Sample(random *rand.Rand) time.Duration
+}
+
+type FixedLatency time.Duration
+
+func (latency FixedLatency) Sample(*rand.Rand) time.Duration {
+	return time.Duration(latency)
+}
+
+type UniformLatency struct {
+	Min, Max time.Duration
+}
+
+func (latency UniformLatency) Sample(random *rand.Rand) time.Duration {
+	if latency.Max <= latency.Min {
+		return latency.Min
+	}
+	return latency.Min + time.Duration(random.Int63n(int64(latency.Max-latency.Min)))
+}
+
+// NormalLatency never returns a negative delay.
+type NormalLatency struct {
+	Mean, StdDev time.Duration
+}
+
+func (latency NormalLatency) Sample(random *rand.Rand) time.Duration {
+	return time.Duration(math.Max(0, random.NormFloat64()*float64(latency.StdDev)+float64(latency.Mean)))
+}
+
+type ExponentialLatency struct {
+	Mean time.Duration
+}
+
+func (latency ExponentialLatency) Sample(random *rand.Rand) time.Duration {
+	return time.Duration(random.ExpFloat64() * float64(latency.Mean))
+}
+
+type Fault string
+
+const (
+	FaultLatency  Fault = "latency"
+	FaultReset    Fault = "reset"
+	FaultTimeout  Fault = "timeout"
+	FaultStatus   Fault = "status"
+	FaultTruncate Fault = "truncate"
+	FaultCorrupt  Fault = "corrupt"
+)
+
+// FaultRule injects faults into the requests it matches, rates are
+// probabilities between 0 and 1. At most one of reset, timeout and status
+// happens per request, truncate and corrupt only apply to real responses.
+type FaultRule struct {
+	// Host matches the host name or host:port, a leading "*." matches every
+	// subdomain. Empty matches every host.
+	Host string
+	// PathPrefix matches the start of the URL path, empty matches every path.
+	PathPrefix string
+	Methods    []string
+
+	Latency     LatencyDistribution
+	LatencyRate float64
+
+	ResetRate float64
+
+	// TimeoutRate requests hang until their context is done or TimeoutAfter
+	// has passed, then fail with a timeout error.
+	TimeoutRate  float64
+	TimeoutAfter time.Duration
+
+	// StatusRate requests are answered with one of StatusCodes without
+	// reaching the server.
+	StatusRate  float64
+	StatusCodes []int
+
+	TruncateRate float64
+	CorruptRate  float64
+}
+
+func (rule *FaultRule) matches(req *http.Request) bool {
+	if rule.Host != "" {
+		host := strings.ToLower(rule.Host)
+		hostname := strings.ToLower(req.URL.Hostname())
+		if !(host == strings.ToLower(req.URL.Host) || host == hostname ||
+			strings.HasPrefix(host, "*.") && strings.HasSuffix(hostname, host[1:])) {
+			return false
+		}
+	}
+	if !strings.HasPrefix(req.URL.Path, rule.PathPrefix) {
+		return false
+	}
+	if len(rule.Methods) == 0 {
+		return true
+	}
+	for _, method := range rule.Methods {
+		if strings.EqualFold(method, req.Method) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChaosTransport injects faults into the requests of Base following the first
+// matching rule. The same seed and request order give the same faults, a
+// transport built without NewChaosTransport uses seed 1.
+type ChaosTransport struct {
+	Base  http.RoundTripper
+	Rules []FaultRule
+
+	mu     sync.Mutex
+	random *rand.Rand
+	counts map[Fault]int
+}
+
+func NewChaosTransport(base http.RoundTripper, seed int64, rules ...FaultRule) *ChaosTransport {
+	return &ChaosTransport{
+		Base:   base,
+		Rules:  rules,
+		random: rand.New(rand.NewSource(seed)),
+		counts: make(map[Fault]int),
+	}
+}
+
+// Counts returns how many times each fault was injected.
+func (transport *ChaosTransport) Counts() map[Fault]int {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	counts := make(map[Fault]int, len(transport.counts))
+	for fault, count := range transport.counts {
+		counts[fault] = count
+	}
+	return counts
+}
+
+// plan holds every random draw of one request, all of them are taken up front
+// so the sequence does not depend on which faults fire.
+type plan struct {
+	faults   map[Fault]bool
+	latency  time.Duration
+	status   int
+	position float64
+}
+
+func (transport *ChaosTransport) plan(rule *FaultRule) plan {
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if transport.random == nil {
+		transport.random = rand.New(rand.NewSource(1))
+	}
+	if transport.counts == nil {
+		transport.counts = make(map[Fault]int)
+	}
+	random := transport.random
+	draw := func(rate float64) bool {
+		return random.Float64() < rate
+	}
+
+	p := plan{faults: make(map[Fault]bool)}
+	if draw(rule.LatencyRate) && rule.Latency != nil {
+		p.faults[FaultLatency], p.latency = true, rule.Latency.Sample(random)
+	}
+	outcome := random.Float64()
+	switch {
+	case outcome < rule.ResetRate:
+		p.faults[FaultReset] = true
+	case outcome < rule.ResetRate+rule.TimeoutRate:
+		p.faults[FaultTimeout] = true
+	case outcome < rule.ResetRate+rule.TimeoutRate+rule.StatusRate && len(rule.StatusCodes) > 0:
+		p.faults[FaultStatus] = true
+	}
+	if len(rule.StatusCodes) > 0 {
+		p.status = rule.StatusCodes[random.Intn(len(rule.StatusCodes))]
+	}
+	answered := p.faults[FaultReset] || p.faults[FaultTimeout] || p.faults[FaultStatus]
+	p.faults[FaultTruncate] = draw(rule.TruncateRate) && !answered
+	p.faults[FaultCorrupt] = draw(rule.CorruptRate) && !answered
+	p.position = random.Float64()
+
+	for fault, injected := range p.faults {
+		if injected {
+			transport.counts[fault]++
+		}
+	}
+	return p
+}
+
+func (transport *ChaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	var rule *FaultRule
+	for i := range transport.Rules {
+		if transport.Rules[i].matches(req) {
+			rule = &transport.Rules[i]
+			break
+		}
+	}
+	if rule == nil {
+		return base.RoundTrip(req)
+	}
+	p := transport.plan(rule)
+
+	if p.faults[FaultLatency] {
+		if err := sleepContext(req, p.latency); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case p.faults[FaultReset]:
+		closeRequestBody(req)
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	case p.faults[FaultTimeout]:
+		closeRequestBody(req)
+		if err := sleepContext(req, rule.TimeoutAfter); err != nil {
+			return nil, err
+		}
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	case p.faults[FaultStatus]:
+		closeRequestBody(req)
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", p.status, http.StatusText(p.status)),
+			StatusCode:    p.status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"X-Chaos-Fault": {string(FaultStatus)}},
+			Body:          http.NoBody,
+			ContentLength: 0,
+			Request:       req,
+		}, nil
+	}
+
+	response, err := base.RoundTrip(req)
+	if err != nil || !p.faults[FaultTruncate] && !p.faults[FaultCorrupt] {
+		return response, err
+	}
+	body, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Header.Set("X-Chaos-Fault", faultList(p.faults))
+	if p.faults[FaultCorrupt] {
+		body = corruptJSON(body, p.position)
+	}
+	if p.faults[FaultTruncate] {
+		response.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body[:int(p.position*float64(len(body)))]), errorReader{io.ErrUnexpectedEOF}))
+		response.ContentLength = -1
+		response.Header.Del("Content-Length")
+		return response, nil
+	}
+	response.Body = nopCloser(body)
+	return response, nil
+}
+
+func faultList(faults map[Fault]bool) string {
+	var list []string
+	for _, fault := range []Fault{FaultLatency, FaultReset, FaultTimeout, FaultStatus, FaultTruncate, FaultCorrupt} {
+		if faults[fault] {
+			list = append(list, string(fault))
+		}
+	}
+	return strings.Join(list, ",")
+}
+
+// corruptJSON replaces a structural character outside of strings so the
+// document no longer parses.
+func corruptJSON(body []byte, position float64) []byte {
+	var structural []int
+	inString, escaped := false, false
+	for i, c := range body {
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case !inString && strings.IndexByte("{}[]:,", c) >= 0:
+			structural = append(structural, i)
+		}
+	}
+	corrupted := append([]byte(nil), body...)
+	if len(structural) == 0 {
+		return append(corrupted, '}')
+	}
+	corrupted[structural[int(position*float64(len(structural)))]] = '#'
+	return corrupted
+}
+
+type errorReader struct {
+	err error
+}
+
+func (reader errorReader) Read([]byte) (int, error) {
+	return 0, reader.err
+}
+
+func sleepContext(req *http.Request, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// closeRequestBody follows the RoundTripper contract for requests that never
+// reach Base.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,115 @@
+package bunker
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestChaosTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"id":"a,b","items":[1,2,3]}`)
+	}))
+	defer server.Close()
+
+	send := func(transport *ChaosTransport, path string) *Requester {
+		return New(server.URL).AddPath(path).SetClient(&http.Client{Transport: transport}).Get().Do()
+	}
+
+	t.Run("testReset", func(t *testing.T) {
+		transport := NewChaosTransport(nil, 1, FaultRule{PathPrefix: "/reset", ResetRate: 1})
+		if req := send(transport, "reset"); !errors.Is(req.Err(), syscall.ECONNRESET) {
+			t.Errorf("invalid reset error %v", req.Errors)
+		}
+		if req := send(transport, "other"); req.HaveError() {
+			t.Errorf("unmatched path must not fail %v", req.Errors)
+		}
+	})
+
+	t.Run("testZeroValue", func(t *testing.T) {
+		transport := &ChaosTransport{Rules: []FaultRule{{StatusRate: 1, StatusCodes: []int{http.StatusBadGateway}}}}
+		if req := send(transport, "zero"); req.HaveError() || req.Response.StatusCode != http.StatusBadGateway {
+			t.Errorf("invalid zero value transport %v", req.Errors)
+		}
+		if counts := transport.Counts(); counts[FaultStatus] != 1 {
+			t.Errorf("invalid counts %v", counts)
+		}
+	})
+
+	t.Run("testTimeout", func(t *testing.T) {
+		transport := NewChaosTransport(nil, 1, FaultRule{TimeoutRate: 1, TimeoutAfter: 10 * time.Millisecond})
+		if req := send(transport, "timeout"); !errors.Is(req.Err(), os.ErrDeadlineExceeded) {
+			t.Errorf("invalid timeout error %v", req.Errors)
+		}
+	})
+
+	t.Run("testStatus", func(t *testing.T) {
+		transport := NewChaosTransport(nil, 1, FaultRule{Host: "127.0.0.1", StatusRate: 1, StatusCodes: []int{http.StatusServiceUnavailable}})
+		req := send(transport, "status")
+		if req.HaveError() || req.Response.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("invalid injected status %v", req.Errors)
+		}
+	})
+
+	t.Run("testTruncateAndCorrupt", func(t *testing.T) {
+		transport := NewChaosTransport(nil, 1, FaultRule{TruncateRate: 1})
+		_, err := io.ReadAll(send(transport, "truncate").Response.Body)
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("invalid truncate error %v", err)
+		}
+
+		transport = NewChaosTransport(nil, 1, FaultRule{CorruptRate: 1})
+		for i := 0; i < 20; i++ {
+			var decoded interface{}
+			body, _ := io.ReadAll(send(transport, "corrupt").Response.Body)
+			if json.Unmarshal(body, &decoded) == nil {
+				t.Fatalf("corrupted body must not decode %s", body)
+			}
+		}
+	})
+
+	t.Run("testDeterministic", func(t *testing.T) {
+		run := func(seed int64) string {
+			transport := NewChaosTransport(nil, seed, FaultRule{
+				Latency: UniformLatency{Max: time.Millisecond}, LatencyRate: 0.5,
+				ResetRate: 0.2, StatusRate: 0.2, StatusCodes: []int{500, 502}, CorruptRate: 0.2,
+			})
+			var outcomes []string
+			for i := 0; i < 30; i++ {
+				req := send(transport, "")
+				switch {
+				case req.HaveError():
+					outcomes = append(outcomes, "reset")
+				default:
+					outcomes = append(outcomes, req.Response.Status+req.Response.Header.Get("X-Chaos-Fault"))
+				}
+			}
+			return strings.Join(outcomes, ";")
+		}
+		first := run(42)
+		if second := run(42); first != second {
+			t.Errorf("same seed must give the same faults\n\tExpected : %v\n\tActual : %v", first, second)
+		}
+		if other := run(7); first == other {
+			t.Error("different seeds should give different faults")
+		}
+	})
+
+	t.Run("testCounts", func(t *testing.T) {
+		transport := NewChaosTransport(nil, 3, FaultRule{ResetRate: 0.5, TruncateRate: 1})
+		for i := 0; i < 10; i++ {
+			send(transport, "")
+		}
+		counts := transport.Counts()
+		if counts[FaultReset]+counts[FaultTruncate] != 10 || counts[FaultReset] == 0 {
+			t.Errorf("invalid fault counts %v", counts)
+		}
+	})
+}
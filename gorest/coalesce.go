@@ -0,0 +1,201 @@
+package bunker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCoalesceHeaders are the headers that tell identical requests apart
+// when NewCoalescer is given none. Authorization and Cookie are always used.
+var DefaultCoalesceHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language"}
+
+// Coalescer shares one upstream call between the identical GET and HEAD
+// requests in flight at the same time, across the requesters it is set on.
+// Shared responses are buffered in memory and every caller reads its own copy
+// of the body. The upstream call uses the client and the context values of
+// the first caller, it is cancelled only once every caller has gone.
+// Requesters with SetLimits are not coalesced, their limits apply to a body
+// read once by one caller.
+type Coalescer struct {
+	headers []string
+
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+	stats CoalesceStats
+}
+
+type CoalesceStats struct {
+	// Requests went through the coalescer.
+	Requests int64
+	// Upstream calls were made for them.
+	Upstream int64
+	// Saved requests shared the call of another one.
+	Saved int64
+}
+
+type coalescedCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+
+	response *http.Response
+	body     []byte
+	err      error
+}
+
+func NewCoalescer(headers ...string) *Coalescer {
+	if len(headers) == 0 {
+		headers = DefaultCoalesceHeaders
+	}
+	return &Coalescer{
+		headers: append([]string{Auth, "Cookie"}, headers...),
+		calls:   make(map[string]*coalescedCall),
+	}
+}
+
+func (base *Requester) SetCoalescer(coalescer *Coalescer) *Requester {
+	base.coalescer = coalescer
+	return base
+}
+
+func (coalescer *Coalescer) Stats() CoalesceStats {
+	coalescer.mu.Lock()
+	defer coalescer.mu.Unlock()
+	return coalescer.stats
+}
+
+// clientDo sends the request, through the coalescer when it can be shared.
+func (base *Requester) clientDo() (*http.Response, error) {
+	if base.coalescer == nil || base.limits != nil || base.Method != GET && base.Method != HEAD ||
+		normalizeMediaType(base.Request.Header.Get("Accept")) == EventStream {
+		return base.Client.Do(base.Request)
+	}
+	return base.coalescer.do(base.coalesceKey(), base.Client, base.Request)
+}
+
+// coalesceKey also tells apart the requesters whose credentials or cookies
+// are added below the request headers.
+func (base *Requester) coalesceKey() string {
+	var key strings.Builder
+	key.WriteString(base.Method + " " + base.Request.URL.String())
+	jar := base.cookieJar
+	if jar == nil && base.httpClient != nil {
+		jar = base.httpClient.Jar
+	}
+	if jar != nil {
+		fmt.Fprintf(&key, "\njar=%p", jar)
+	}
+	if base.digestAuth != nil {
+		key.WriteString("\ndigest=" + base.digestAuth.Username)
+	}
+	for _, name := range base.coalescer.headers {
+		values := append([]string(nil), base.Request.Header.Values(name)...)
+		sort.Strings(values)
+		key.WriteString("\n" + http.CanonicalHeaderKey(name) + "=" + strings.Join(values, ","))
+	}
+	return key.String()
+}
+
+func (coalescer *Coalescer) do(key string, client *http.Client, req *http.Request) (*http.Response, error) {
+	coalescer.mu.Lock()
+	coalescer.stats.Requests++
+	call, ok := coalescer.calls[key]
+	if ok {
+		coalescer.stats.Saved++
+	} else {
+		ctx, cancel := context.WithCancel(detachedContext{req.Context()})
+		call = &coalescedCall{done: make(chan struct{}), cancel: cancel}
+		coalescer.calls[key] = call
+		coalescer.stats.Upstream++
+		go coalescer.upstream(key, call, client, req.Clone(ctx))
+	}
+	call.waiters++
+	coalescer.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.copy(req)
+	case <-req.Context().Done():
+		coalescer.leave(key, call)
+		return nil, req.Context().Err()
+	}
+}
+
+// upstream makes the shared call and buffers its body, done is closed even
+// when the client panics.
+func (coalescer *Coalescer) upstream(key string, call *coalescedCall, client *http.Client, req *http.Request) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			call.err = fmt.Errorf("coalesced request panicked: %v", recovered)
+		}
+		call.cancel()
+		coalescer.mu.Lock()
+		if coalescer.calls[key] == call {
+			delete(coalescer.calls, key)
+		}
+		coalescer.mu.Unlock()
+		close(call.done)
+	}()
+	call.response, call.err = client.Do(req)
+	if call.err == nil {
+		defer call.response.Body.Close()
+		call.body, call.err = io.ReadAll(call.response.Body)
+	}
+}
+
+// leave cancels the upstream call when no caller waits for it anymore.
+func (coalescer *Coalescer) leave(key string, call *coalescedCall) {
+	coalescer.mu.Lock()
+	defer coalescer.mu.Unlock()
+	call.waiters--
+	if call.waiters == 0 {
+		call.cancel()
+		if coalescer.calls[key] == call {
+			delete(coalescer.calls, key)
+		}
+	}
+}
+
+// detachedContext keeps the values of its parent but not its deadline and
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (ctx detachedContext) Value(key interface{}) interface{} {
+	return ctx.parent.Value(key)
+}
+
+func (call *coalescedCall) copy(req *http.Request) (*http.Response, error) {
+	if call.err != nil {
+		return nil, call.err
+	}
+	response := *call.response
+	response.Header = call.response.Header.Clone()
+	response.Trailer = call.response.Trailer.Clone()
+	response.Body = io.NopCloser(bytes.NewReader(call.body))
+	if req.Method != HEAD {
+		response.ContentLength = int64(len(call.body))
+	}
+	response.Request = req
+	return &response, nil
+}
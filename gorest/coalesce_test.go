@@ -0,0 +1,139 @@
+package bunker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCoalescer(t *testing.T) {
+	var hits int64
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		_, _ = io.WriteString(w, `{"feature":"on","auth":"`+r.Header.Get(Auth)+`"}`)
+	}))
+	defer server.Close()
+
+	waitRequests := func(coalescer *Coalescer, requests int64) {
+		deadline := time.Now().Add(5 * time.Second)
+		for coalescer.Stats().Requests < requests && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	t.Run("testIdenticalRequestsShareOneCall", func(t *testing.T) {
+		atomic.StoreInt64(&hits, 0)
+		coalescer := NewCoalescer()
+		bodies := make([]string, 5)
+		var wg sync.WaitGroup
+		for i := range bodies {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				req := New(server.URL).AddPath("slow").SetCoalescer(coalescer).Get().Do()
+				if req.Response != nil {
+					data, _ := io.ReadAll(req.Response.Body)
+					bodies[i] = string(data)
+				}
+			}(i)
+		}
+		waitRequests(coalescer, 5)
+		close(release)
+		wg.Wait()
+
+		for _, body := range bodies {
+			if body != `{"feature":"on","auth":""}` {
+				t.Errorf("every caller must read the whole body, got %q", body)
+			}
+		}
+		if hits := atomic.LoadInt64(&hits); hits != 1 {
+			t.Errorf("invalid upstream calls\n\tExpected : %v\n\tActual : %v", 1, hits)
+		}
+		expected := CoalesceStats{Requests: 5, Upstream: 1, Saved: 4}
+		if stats := coalescer.Stats(); stats != expected {
+			t.Errorf("invalid stats\n\tExpected : %+v\n\tActual : %+v", expected, stats)
+		}
+	})
+
+	t.Run("testLeaderCancelled", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+			_, _ = io.WriteString(w, "ok")
+		}))
+		defer server.Close()
+
+		coalescer := NewCoalescer()
+		ctx, cancel := context.WithCancel(context.Background())
+		leader, follower := make(chan *Requester), make(chan *Requester)
+		go func() {
+			leader <- New(server.URL).SetContext(ctx).SetCoalescer(coalescer).Get().Do()
+		}()
+		waitRequests(coalescer, 1)
+		go func() {
+			follower <- New(server.URL).SetCoalescer(coalescer).Get().Do()
+		}()
+		waitRequests(coalescer, 2)
+
+		cancel()
+		if req := <-leader; !errors.Is(req.Err(), context.Canceled) {
+			t.Errorf("invalid leader error\n\tExpected : %v\n\tActual : %v", context.Canceled, req.Err())
+		}
+		close(release)
+		req := <-follower
+		if req.Err() != nil {
+			t.Fatalf("follower must not share the leader cancellation, got %v", req.Err())
+		}
+		if data, _ := io.ReadAll(req.Response.Body); string(data) != "ok" {
+			t.Errorf("invalid body\n\tExpected : %v\n\tActual : %v", "ok", string(data))
+		}
+		if stats := coalescer.Stats(); stats.Upstream != 1 {
+			t.Errorf("invalid upstream calls\n\tExpected : %v\n\tActual : %v", 1, stats.Upstream)
+		}
+	})
+
+	t.Run("testLimitsAreNotCoalesced", func(t *testing.T) {
+		coalescer := NewCoalescer()
+		req := New(server.URL).SetCoalescer(coalescer).SetLimits(Limits{MaxBodySize: 8}).Get().Do()
+		if stats := coalescer.Stats(); stats.Requests != 0 {
+			t.Errorf("requesters with limits are not coalesced, got %+v", stats)
+		}
+		var limitErr *LimitError
+		if !errors.As(req.Err(), &limitErr) {
+			t.Errorf("body limit must apply, got %v", req.Err())
+		}
+	})
+
+	t.Run("testCredentialsAreNotShared", func(t *testing.T) {
+		coalescer := NewCoalescer()
+		first := New(server.URL).SetCoalescer(coalescer).SetToken("first")
+		second := New(server.URL).SetCoalescer(coalescer).SetToken("second")
+		first.Get().initRequestClient()
+		second.Get().initRequestClient()
+		if first.coalesceKey() == second.coalesceKey() {
+			t.Errorf("requests with other credentials must not be coalesced")
+		}
+	})
+
+	t.Run("testPostIsNotCoalesced", func(t *testing.T) {
+		coalescer := NewCoalescer()
+		New(server.URL).SetCoalescer(coalescer).Post().SetPayload("x").Do()
+		if stats := coalescer.Stats(); stats.Requests != 0 {
+			t.Errorf("only GET and HEAD requests are coalesced, got %+v", stats)
+		}
+	})
+}
@@ -0,0 +1,307 @@
+package bunker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/yudhiana/bunker"
+)
+
+const (
+	Xml    string = "application/xml"
+	NDJson string = "application/x-ndjson"
+)
+
+// Codec encodes request payloads and decodes response bodies of one media type.
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// Codecs maps media types to codecs. Types ending in +json or +xml fall back to
+// the codec of application/json or application/xml.
+type Codecs struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+}
+
+// DefaultCodecs is used by every requester without SetCodecs. It knows JSON,
+// XML, NDJSON and form encoding, MessagePack or Protobuf codecs can be added
+// with Register without this package depending on them.
+var DefaultCodecs = NewCodecs(JSONCodec{}, XMLCodec{}, NDJSONCodec{}, FormCodec{})
+
+func NewCodecs(codecs ...Codec) *Codecs {
+	registry := &Codecs{codecs: make(map[string]Codec)}
+	for _, codec := range codecs {
+		registry.Register(codec)
+	}
+	return registry
+}
+
+// Register adds codec for its own content type and the extra media types.
+func (registry *Codecs) Register(codec Codec, mediaTypes ...string) *Codecs {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, mediaType := range append([]string{codec.ContentType()}, mediaTypes...) {
+		registry.codecs[normalizeMediaType(mediaType)] = codec
+	}
+	if aliases, found := codecAliases[normalizeMediaType(codec.ContentType())]; found {
+		for _, alias := range aliases {
+			if _, taken := registry.codecs[alias]; !taken {
+				registry.codecs[alias] = codec
+			}
+		}
+	}
+	return registry
+}
+
+var codecAliases = map[string][]string{
+	Xml: {"text/xml"},
+}
+
+// Lookup finds the codec of a Content-Type or Accept value, parameters such as
+// charset are ignored.
+func (registry *Codecs) Lookup(contentType string) (Codec, bool) {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	for _, candidate := range strings.Split(contentType, ",") {
+		mediaType := normalizeMediaType(candidate)
+		if codec, found := registry.codecs[mediaType]; found {
+			return codec, true
+		}
+		if strings.HasSuffix(mediaType, "+json") {
+			if codec, found := registry.codecs[Json]; found {
+				return codec, true
+			}
+		}
+		if strings.HasSuffix(mediaType, "+xml") {
+			if codec, found := registry.codecs[Xml]; found {
+				return codec, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func normalizeMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(contentType))
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return mediaType
+}
+
+func (base *Requester) SetCodecs(codecs *Codecs) *Requester {
+	base.codecs = codecs
+	return base
+}
+
+// SetAccept sets the Accept header, it also picks the codec of a response
+// without Content-Type.
+func (base *Requester) SetAccept(mediaTypes ...string) *Requester {
+	base.Header["Accept"] = []string{strings.Join(mediaTypes, ", ")}
+	return base
+}
+
+func (base *Requester) codecRegistry() *Codecs {
+	if base.codecs != nil {
+		return base.codecs
+	}
+	return DefaultCodecs
+}
+
+// encodePayload turns the value given to SetPayload into the request body.
+func (base *Requester) encodePayload() error {
+	switch body := base.body.(type) {
+	case nil:
+		base.payload = nil
+		return nil
+	case string:
+		base.payload, base.payloadContentType = []byte(body), Json
+		return nil
+	case []byte:
+		base.payload, base.payloadContentType = body, Json
+		return nil
+	}
+
+	contentType := headerValue(base.Header, "Content-Type")
+	if bunker.IsEmptyString(contentType) {
+		contentType = Json
+	}
+	codec, found := base.codecRegistry().Lookup(contentType)
+	if !found {
+		return fmt.Errorf("no codec registered for %s", contentType)
+	}
+	payload, err := codec.Marshal(base.body)
+	if err != nil {
+		return err
+	}
+	base.payload, base.payloadContentType = payload, codec.ContentType()
+	return nil
+}
+
+// Decode reads the response body into target with the codec of the response
+// Content-Type, or of the Accept header when that one has no codec. The body
+// stays readable afterwards.
+func (base *Requester) Decode(target interface{}) *Requester {
+	if base.Response == nil {
+		base.Errors = append(base.Errors, errors.New("can't decode before response"))
+		return base
+	}
+	errCount := len(base.Errors)
+	data := base.readAll(base.Response.Body)
+	if base.Response.Body != nil {
+		base.Response.Body.Close()
+	}
+	base.Response.Body = nopCloser(data)
+	if len(base.Errors) > errCount {
+		return base
+	}
+
+	codec, err := base.responseCodec()
+	if err != nil {
+		base.Errors = append(base.Errors, err)
+		return base
+	}
+	if err := codec.Unmarshal(data, target); err != nil {
+		base.Errors = append(base.Errors, err)
+	}
+	return base
+}
+
+func (base *Requester) responseCodec() (Codec, error) {
+	contentType := base.Response.Header.Get("Content-Type")
+	accept := headerValue(base.Header, "Accept")
+	if bunker.IsEmptyString(contentType) && bunker.IsEmptyString(accept) {
+		contentType = Json
+	}
+	for _, candidate := range []string{contentType, accept} {
+		if codec, found := base.codecRegistry().Lookup(candidate); found {
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("no codec registered for %s", contentType)
+}
+
+// headerValue looks a header up without relying on canonical keys, since
+// Header is filled with whatever casing the caller used.
+func headerValue(header map[string][]string, name string) string {
+	if values := header[name]; len(values) > 0 {
+		return values[0]
+	}
+	for key, values := range header {
+		if strings.EqualFold(key, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string { return Json }
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type XMLCodec struct{}
+
+func (XMLCodec) ContentType() string { return Xml }
+
+func (XMLCodec) Marshal(v interface{}) ([]byte, error) { return xml.Marshal(v) }
+
+func (XMLCodec) Unmarshal(data []byte, v interface{}) error { return xml.Unmarshal(data, v) }
+
+// NDJSONCodec writes a slice as one JSON document per line and reads lines
+// back into a pointer to a slice.
+type NDJSONCodec struct{}
+
+func (NDJSONCodec) ContentType() string { return NDJson }
+
+func (NDJSONCodec) Marshal(v interface{}) ([]byte, error) {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		line, err := json.Marshal(v)
+		return append(line, '\n'), err
+	}
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	for i := 0; i < value.Len(); i++ {
+		if err := encoder.Encode(value.Index(i).Interface()); err != nil {
+			return nil, err
+		}
+	}
+	return out.Bytes(), nil
+}
+
+func (NDJSONCodec) Unmarshal(data []byte, v interface{}) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer || target.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("ndjson needs a pointer to a slice, got %T", v)
+	}
+	list := target.Elem()
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		item := reflect.New(list.Type().Elem())
+		if err := json.Unmarshal(line, item.Interface()); err != nil {
+			return err
+		}
+		list.Set(reflect.Append(list, item.Elem()))
+	}
+	return scanner.Err()
+}
+
+// FormCodec encodes url.Values, string maps and query tagged structs as
+// application/x-www-form-urlencoded.
+type FormCodec struct{}
+
+func (FormCodec) ContentType() string { return Form }
+
+func (FormCodec) Marshal(v interface{}) ([]byte, error) {
+	switch data := v.(type) {
+	case url.Values:
+		return []byte(data.Encode()), nil
+	case map[string][]string:
+		return []byte(url.Values(data).Encode()), nil
+	case map[string]string:
+		values := make(url.Values)
+		for k, value := range data {
+			values.Set(k, value)
+		}
+		return []byte(values.Encode()), nil
+	}
+	values, err := EncodeQuery(v)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(values.Encode()), nil
+}
+
+func (FormCodec) Unmarshal(data []byte, v interface{}) error {
+	target, isValues := v.(*url.Values)
+	if !isValues {
+		return fmt.Errorf("form needs a *url.Values, got %T", v)
+	}
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	*target = values
+	return nil
+}
@@ -0,0 +1,109 @@
+package bunker
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type codecInvoice struct {
+	XMLName xml.Name `xml:"invoice" json:"-"`
+	ID      int      `xml:"id" json:"id"`
+	Total   string   `xml:"total" json:"total"`
+}
+
+type upperCodec struct{}
+
+func (upperCodec) ContentType() string { return "text/upper" }
+
+func (upperCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(strings.ToUpper(v.(*codecInvoice).Total)), nil
+}
+
+func (upperCodec) Unmarshal(data []byte, v interface{}) error {
+	v.(*codecInvoice).Total = strings.ToLower(string(data))
+	return nil
+}
+
+func TestCodecs(t *testing.T) {
+	var contentType, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		switch r.URL.Path {
+		case "/xml":
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			_, _ = io.WriteString(w, `<invoice><id>7</id><total>9.50</total></invoice>`)
+		case "/problem":
+			w.Header().Set("Content-Type", "application/problem+json")
+			_, _ = io.WriteString(w, `{"id":8,"total":"1.00"}`)
+		case "/stream":
+			_, _ = io.WriteString(w, "{\"id\":1}\n\n{\"id\":2}\n")
+		case "/upper":
+			_, _ = io.WriteString(w, "ABC")
+		}
+	}))
+	defer server.Close()
+
+	t.Run("testXML", func(t *testing.T) {
+		var invoice codecInvoice
+		req := New(server.URL).Post().AddPath("/xml").SetContentType(Xml).
+			SetPayload(codecInvoice{ID: 1, Total: "2"}).Do().Decode(&invoice)
+		if req.HaveError() {
+			t.Fatal(req.Errors)
+		}
+		if contentType != Xml || body != `<invoice><id>1</id><total>2</total></invoice>` {
+			t.Errorf("invalid xml request\n\tActual : %s %s", contentType, body)
+		}
+		if invoice.ID != 7 || invoice.Total != "9.50" {
+			t.Errorf("invalid xml response %+v", invoice)
+		}
+		if data, _ := io.ReadAll(req.Response.Body); len(data) == 0 {
+			t.Error("body must stay readable after decode")
+		}
+	})
+
+	t.Run("testJSONSuffix", func(t *testing.T) {
+		var invoice codecInvoice
+		req := New(server.URL).Get().AddPath("/problem").Do().Decode(&invoice)
+		if req.HaveError() || invoice.ID != 8 {
+			t.Errorf("invalid +json decode %+v %v", invoice, req.Errors)
+		}
+		if contentType != "" {
+			t.Errorf("request without body must not get a content type, got %s", contentType)
+		}
+	})
+
+	t.Run("testNDJSON", func(t *testing.T) {
+		var invoices []codecInvoice
+		req := New(server.URL).Post().AddPath("/stream").SetContentType(NDJson).SetAccept(NDJson).
+			SetPayload([]codecInvoice{{ID: 1}, {ID: 2}}).Do().Decode(&invoices)
+		if req.HaveError() || len(invoices) != 2 || invoices[1].ID != 2 {
+			t.Errorf("invalid ndjson decode %+v %v", invoices, req.Errors)
+		}
+		if strings.Count(body, "\n") != 2 {
+			t.Errorf("invalid ndjson request %q", body)
+		}
+	})
+
+	t.Run("testCustomCodec", func(t *testing.T) {
+		codecs := NewCodecs(JSONCodec{}).Register(upperCodec{})
+		var invoice codecInvoice
+		req := New(server.URL).Post().AddPath("/upper").SetCodecs(codecs).SetContentType("text/upper").
+			SetAccept("text/upper").SetPayload(&codecInvoice{Total: "xyz"}).Do().Decode(&invoice)
+		if req.HaveError() || body != "XYZ" || invoice.Total != "abc" {
+			t.Errorf("invalid custom codec %q %+v %v", body, invoice, req.Errors)
+		}
+	})
+
+	t.Run("testUnknownMediaType", func(t *testing.T) {
+		req := New(server.URL).Post().SetContentType("application/msgpack").SetPayload(codecInvoice{}).Do()
+		if !req.HaveError() {
+			t.Error("payload without codec must fail")
+		}
+	})
+}
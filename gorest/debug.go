@@ -0,0 +1,324 @@
+package bunker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yudhiana/bunker"
+)
+
+// DefaultDebugBodySize caps the bodies printed by the debug output.
+const DefaultDebugBodySize = 4 << 10
+
+type DebugFormat int
+
+const (
+	DebugText DebugFormat = iota
+	// DebugJSON logs one DebugRecord per exchange as a single JSON line.
+	DebugJSON
+)
+
+// CardNumberPattern matches payment card numbers, with or without separators.
+var CardNumberPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+type DebugLogger interface {
+	Debug(message string)
+}
+
+type DebugLoggerFunc func(message string)
+
+func (f DebugLoggerFunc) Debug(message string) {
+	f(message)
+}
+
+// WriterDebugLogger writes every message on its own line.
+type WriterDebugLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterDebugLogger(w io.Writer) *WriterDebugLogger {
+	return &WriterDebugLogger{w: w}
+}
+
+func (logger *WriterDebugLogger) Debug(message string) {
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	fmt.Fprintln(logger.w, message)
+}
+
+// RedactionPolicy decides what the debug output hides.
+type RedactionPolicy struct {
+	// Headers defaults to DefaultRedactedHeaders.
+	Headers []string
+	// JSONPaths are dot separated key paths from the document root where "*"
+	// matches any key or index, a path of a single key matches it at any
+	// depth. "password", "card.number" and "items.*.token" are all valid.
+	JSONPaths []string
+	// Patterns are replaced in header values and bodies.
+	Patterns []*regexp.Regexp
+}
+
+type DebugOptions struct {
+	Format DebugFormat
+	// Logger defaults to the colored info log for DebugText and to standard
+	// output for DebugJSON.
+	Logger    DebugLogger
+	Redaction RedactionPolicy
+	// MaxBodySize defaults to DefaultDebugBodySize, a negative value prints
+	// no body.
+	MaxBodySize int
+
+	// errorLogger receives the errors of Do, the colored error log when
+	// Logger was left to its default
+	errorLogger DebugLogger
+}
+
+// SetDebugOptions configures the output of SetDebug, it does not enable it.
+func (base *Requester) SetDebugOptions(options DebugOptions) *Requester {
+	options.errorLogger = options.Logger
+	if options.Logger == nil {
+		options.Logger = DebugLoggerFunc(bunker.LogInfo)
+		options.errorLogger = DebugLoggerFunc(bunker.PrintErr)
+		if options.Format == DebugJSON {
+			options.Logger = NewWriterDebugLogger(os.Stdout)
+			options.errorLogger = options.Logger
+		}
+	}
+	if options.MaxBodySize == 0 {
+		options.MaxBodySize = DefaultDebugBodySize
+	}
+	if options.Redaction.Headers == nil {
+		options.Redaction.Headers = DefaultRedactedHeaders
+	}
+	base.debugOptions = &options
+	return base
+}
+
+func (base *Requester) debugSettings() *DebugOptions {
+	if base.debugOptions == nil {
+		base.SetDebugOptions(DebugOptions{})
+	}
+	return base.debugOptions
+}
+
+// DebugRecord is the structured form of one debugged exchange.
+type DebugRecord struct {
+	Time                  time.Time           `json:"time"`
+	Method                string              `json:"method"`
+	URL                   string              `json:"url"`
+	Route                 string              `json:"route"`
+	Endpoint              string              `json:"endpoint,omitempty"`
+	Proto                 string              `json:"proto,omitempty"`
+	Redirects             []string            `json:"redirects,omitempty"`
+	RequestHeaders        map[string][]string `json:"request_headers,omitempty"`
+	RequestBody           string              `json:"request_body,omitempty"`
+	RequestBodyTruncated  bool                `json:"request_body_truncated,omitempty"`
+	Status                string              `json:"status,omitempty"`
+	StatusCode            int                 `json:"status_code,omitempty"`
+	ResponseHeaders       map[string][]string `json:"response_headers,omitempty"`
+	ResponseBody          string              `json:"response_body,omitempty"`
+	ResponseBodyTruncated bool                `json:"response_body_truncated,omitempty"`
+	ReceivedAt            *time.Time          `json:"received_at,omitempty"`
+	DurationSeconds       float64             `json:"duration_seconds"`
+	Error                 string              `json:"error,omitempty"`
+}
+
+func (base *Requester) debugRecord() DebugRecord {
+	options := base.debugSettings()
+	record := DebugRecord{
+		Time:           time.Now(),
+		Method:         base.Method,
+		URL:            options.Redaction.text(redactedURL(base.Request)),
+		Route:          base.route(),
+		Endpoint:       base.endpoint,
+		Proto:          base.Request.Proto,
+		RequestHeaders: options.Redaction.headers(base.Request.Header),
+	}
+	for _, redirect := range base.redirects {
+		record.Redirects = append(record.Redirects, options.Redaction.text(redirect.String()))
+	}
+	record.RequestBody, record.RequestBodyTruncated = options.body(base.payload, true, base.Request.Header.Get("Content-Type"))
+	if errs := base.Errors[base.attemptErrorsFrom:]; len(errs) > 0 {
+		record.Error = fmt.Sprint(errs)
+	}
+	if base.Response != nil {
+		record.Status = base.Response.Status
+		record.StatusCode = base.Response.StatusCode
+		record.ResponseHeaders = options.Redaction.headers(base.Response.Header)
+		receivedAt := base.timeIn
+		record.ReceivedAt = &receivedAt
+		record.DurationSeconds = base.timeRequest.Seconds()
+		peeked, complete := base.peekResponseBody(options)
+		record.ResponseBody, record.ResponseBodyTruncated = options.body(peeked, complete, base.Response.Header.Get("Content-Type"))
+		if base.Response.ContentLength < 0 && options.MaxBodySize >= 0 {
+			record.ResponseBody = debugUnknownLength
+		}
+	}
+	return record
+}
+
+func (policy RedactionPolicy) headers(header http.Header) map[string][]string {
+	redacted := make(map[string][]string, len(header))
+	for name, values := range header {
+		copied := make([]string, len(values))
+		for i, value := range values {
+			copied[i] = policy.text(value)
+			for _, sensitive := range policy.Headers {
+				if strings.EqualFold(name, sensitive) {
+					copied[i] = Redacted
+				}
+			}
+		}
+		redacted[name] = copied
+	}
+	return redacted
+}
+
+func (policy RedactionPolicy) text(value string) string {
+	for _, pattern := range policy.Patterns {
+		value = pattern.ReplaceAllString(value, Redacted)
+	}
+	return value
+}
+
+// body redacts before it truncates so a cut cannot reveal part of a value,
+// complete tells whether data is the whole body.
+func (options *DebugOptions) body(data []byte, complete bool, contentType string) (string, bool) {
+	if options.MaxBodySize < 0 || len(data) == 0 {
+		return "", false
+	}
+	if len(options.Redaction.JSONPaths) > 0 && isJSONType(contentType) {
+		var document interface{}
+		if !complete || json.Unmarshal(data, &document) != nil {
+			return "[body omitted, it could not be parsed for redaction]", !complete
+		}
+		data, _ = json.Marshal(options.Redaction.redactJSON(document, nil))
+	}
+	text, truncated := options.Redaction.text(string(data)), !complete
+	if len(text) > options.MaxBodySize {
+		text, truncated = text[:options.MaxBodySize], true
+	}
+	if truncated {
+		text += "... (truncated)"
+	}
+	return text, truncated
+}
+
+// debugCaptureSize is the part of a response body read for the debug output
+// when JSON fields are redacted, larger bodies cannot be redacted and are
+// left out.
+const debugCaptureSize = 64 << 10
+
+// debugUnknownLength stands for a response body that was not read ahead.
+const debugUnknownLength = "[body of unknown length, not read ahead]"
+
+// peekResponseBody reads the start of a response body of known length for
+// the debug output and puts it back in front of the rest, so the caller reads
+// the same bytes and the same error. Bodies of unknown length, streamed or
+// long-polled ones, are never read ahead so debugging does not change when Do
+// returns.
+func (base *Requester) peekResponseBody(options *DebugOptions) ([]byte, bool) {
+	body, length := base.Response.Body, base.Response.ContentLength
+	if options.MaxBodySize < 0 || body == nil || body == http.NoBody || length <= 0 ||
+		normalizeMediaType(base.Response.Header.Get("Content-Type")) == EventStream {
+		return nil, false
+	}
+	limit := int64(options.MaxBodySize)
+	if len(options.Redaction.JSONPaths) > 0 && limit < debugCaptureSize {
+		limit = debugCaptureSize
+	}
+	if length < limit {
+		limit = length
+	}
+	peeked, err := io.ReadAll(io.LimitReader(body, limit))
+	rest := io.Reader(body)
+	if err != nil {
+		rest = errorReader{err}
+	}
+	base.Response.Body = &peekedBody{Reader: io.MultiReader(bytes.NewReader(peeked), rest), Closer: body}
+	return peeked, err == nil && int64(len(peeked)) == length
+}
+
+// printErrors reports the errors of Do with the redaction of the debug
+// output, whether debugging is enabled or not.
+func (base *Requester) printErrors() {
+	options := base.debugSettings()
+	message := options.Redaction.text(fmt.Sprint(base.Errors))
+	if options.Format == DebugJSON {
+		data, _ := json.Marshal(struct {
+			Time  time.Time `json:"time"`
+			Error string    `json:"error"`
+		}{time.Now(), message})
+		message = string(data)
+	}
+	options.errorLogger.Debug(message)
+}
+
+// debugReceivedAt is the RECEIVED AT line, left out without a response.
+func debugReceivedAt(receivedAt *time.Time) string {
+	if receivedAt == nil {
+		return ""
+	}
+	return "\tRECEIVED AT     : " + receivedAt.Format(time.RFC1123) + "\n"
+}
+
+// orDash prints an empty debug field as "-".
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+func (policy RedactionPolicy) redactJSON(document interface{}, path []string) interface{} {
+	switch document := document.(type) {
+	case map[string]interface{}:
+		for key, value := range document {
+			document[key] = policy.redactValue(value, append(path, key))
+		}
+	case []interface{}:
+		for i, value := range document {
+			document[i] = policy.redactValue(value, append(path, strconv.Itoa(i)))
+		}
+	}
+	return document
+}
+
+func (policy RedactionPolicy) redactValue(value interface{}, path []string) interface{} {
+	for _, pattern := range policy.JSONPaths {
+		if matchJSONPath(strings.Split(pattern, "."), path) {
+			return Redacted
+		}
+	}
+	return policy.redactJSON(value, path)
+}
+
+func matchJSONPath(pattern, path []string) bool {
+	if len(pattern) == 1 {
+		return pattern[0] == "*" || strings.EqualFold(pattern[0], path[len(path)-1])
+	}
+	if len(pattern) != len(path) {
+		return false
+	}
+	for i := range pattern {
+		if pattern[i] != "*" && !strings.EqualFold(pattern[i], path[i]) {
+			return false
+		}
+	}
+	return true
+}
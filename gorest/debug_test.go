@@ -0,0 +1,198 @@
+package bunker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugRedaction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", Json)
+		w.Header().Set("Set-Cookie", "sid=session-secret")
+		_, _ = io.WriteString(w, `{"card":{"number":"4111 1111 1111 1111","holder":"a"},"items":[{"token":"t1","name":"b"}],"note":"`+strings.Repeat("x", 100)+`"}`)
+	}))
+	defer server.Close()
+
+	t.Run("testText", func(t *testing.T) {
+		var messages []string
+		New(server.URL).SetDebug(true).SetToken("bearer-secret").SetBasicAuth("user", "basic-secret").
+			SetDebugOptions(DebugOptions{
+				Logger:      DebugLoggerFunc(func(message string) { messages = append(messages, message) }),
+				MaxBodySize: 80,
+				Redaction:   RedactionPolicy{JSONPaths: []string{"items.*.token", "holder"}, Patterns: []*regexp.Regexp{CardNumberPattern}},
+			}).
+			SetPayload(map[string]string{"pan": "5500-0000-0000-0004"}).Post().Do()
+
+		if len(messages) != 1 {
+			t.Fatalf("invalid messages\n\tExpected : %v\n\tActual : %v", 1, len(messages))
+		}
+		for _, secret := range []string{"bearer-secret", "dXNlcjpiYXNpYy1zZWNyZXQ", "5500", "4111", "t1", `"a"`} {
+			if strings.Contains(messages[0], secret) {
+				t.Errorf("debug output leaks %q\n%s", secret, messages[0])
+			}
+		}
+		if !strings.Contains(messages[0], `"name":"b"`) || !strings.Contains(messages[0], "... (truncated)") {
+			t.Errorf("invalid debug body\n%s", messages[0])
+		}
+	})
+
+	t.Run("testJSON", func(t *testing.T) {
+		var buffer bytes.Buffer
+		New(server.URL).SetDebug(true).SetToken("bearer-secret").
+			SetDebugOptions(DebugOptions{Format: DebugJSON, Logger: NewWriterDebugLogger(&buffer), MaxBodySize: -1}).
+			Get().Do()
+
+		var record DebugRecord
+		if err := json.Unmarshal(buffer.Bytes(), &record); err != nil {
+			t.Fatalf("invalid JSON record %v\n%s", err, buffer.String())
+		}
+		if record.StatusCode != http.StatusOK || record.Method != GET || record.ResponseBody != "" {
+			t.Errorf("invalid record %+v", record)
+		}
+		if record.RequestHeaders[Auth][0] != Redacted || record.ResponseHeaders["Set-Cookie"][0] != Redacted {
+			t.Errorf("invalid redacted headers %v %v", record.RequestHeaders, record.ResponseHeaders)
+		}
+	})
+
+	t.Run("testErrors", func(t *testing.T) {
+		dead := httptest.NewServer(http.NotFoundHandler())
+		dead.Close()
+		var messages []string
+		New(dead.URL).Query("token=query-secret").
+			SetDebugOptions(DebugOptions{
+				Logger:    DebugLoggerFunc(func(message string) { messages = append(messages, message) }),
+				Redaction: RedactionPolicy{Patterns: []*regexp.Regexp{regexp.MustCompile(`token=[^&\s"]+`)}},
+			}).
+			Get().Do()
+
+		if len(messages) != 1 || strings.Contains(messages[0], "query-secret") || !strings.Contains(messages[0], Redacted) {
+			t.Errorf("errors must go through the redacted debug logger %v", messages)
+		}
+	})
+}
+
+func TestDebugKeepsBody(t *testing.T) {
+	large := strings.Repeat("0123456789", 1000)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			w.Header().Set("Content-Length", strconv.Itoa(len(large)))
+			_, _ = io.WriteString(w, large)
+		case "/stream":
+			_, _ = io.WriteString(w, "first")
+			w.(http.Flusher).Flush()
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			_, _ = io.WriteString(w, " last")
+		default:
+			body, _ := io.ReadAll(r.Body)
+			_, _ = w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	var messages []string
+	logger := DebugLoggerFunc(func(message string) { messages = append(messages, message) })
+
+	t.Run("testSmallBody", func(t *testing.T) {
+		messages = nil
+		req := New(server.URL).SetDebug(true).SetDebugOptions(DebugOptions{Logger: logger}).SetPayload("echo").Post().Do()
+		body, err := io.ReadAll(req.Response.Body)
+		if err != nil || string(body) != "echo" {
+			t.Errorf("invalid body after debug\n\tExpected : %v\n\tActual : %v", "echo", string(body))
+		}
+		if len(messages) != 1 || strings.Count(messages[0], "echo") != 2 {
+			t.Errorf("debug output must contain both bodies\n%v", messages)
+		}
+	})
+
+	t.Run("testLargeBody", func(t *testing.T) {
+		messages = nil
+		req := New(server.URL).AddPath("large").SetDebug(true).SetDebugOptions(DebugOptions{Logger: logger, MaxBodySize: 100}).Get().Do()
+		body, err := io.ReadAll(req.Response.Body)
+		if err != nil || string(body) != large {
+			t.Errorf("invalid body after debug\n\tExpected : %v bytes\n\tActual : %v bytes", len(large), len(body))
+		}
+		if len(messages) != 1 || !strings.Contains(messages[0], large[:100]+"... (truncated)") || strings.Contains(messages[0], large[:101]) {
+			t.Errorf("invalid truncated debug body\n%v", messages)
+		}
+	})
+
+	t.Run("testStreamNotReadAhead", func(t *testing.T) {
+		messages = nil
+		done := make(chan *Requester, 1)
+		go func() {
+			done <- New(server.URL).AddPath("stream").SetDebug(true).SetDebugOptions(DebugOptions{Logger: logger}).Get().Do()
+		}()
+		var req *Requester
+		select {
+		case req = <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("debug output must not wait for a streamed body")
+		}
+		close(release)
+		body, err := io.ReadAll(req.Response.Body)
+		if err != nil || string(body) != "first last" {
+			t.Errorf("invalid body after debug\n\tExpected : %v\n\tActual : %v", "first last", string(body))
+		}
+		if len(messages) != 1 || !strings.Contains(messages[0], debugUnknownLength) {
+			t.Errorf("invalid debug body\n%v", messages)
+		}
+	})
+
+	t.Run("testDecodeAfterDebug", func(t *testing.T) {
+		var decoded map[string]int
+		req := New(server.URL).SetDebug(true).SetDebugOptions(DebugOptions{Logger: logger}).
+			SetPayload(map[string]interface{}{"a": 1}).SetAccept(Json).Post().Do().Decode(&decoded)
+		if req.HaveError() || decoded["a"] != 1 {
+			t.Errorf("invalid decoded body %v %v", decoded, req.Errors)
+		}
+	})
+
+	t.Run("testFailedExchange", func(t *testing.T) {
+		messages = nil
+		var buffer bytes.Buffer
+		req := New("http://127.0.0.1:1").SetDebug(true).SetDebugOptions(DebugOptions{Logger: logger}).Get().Do()
+		// the debug output, then the error line of Do
+		if !req.HaveError() || len(messages) != 2 || !strings.Contains(messages[0], "connect") || !strings.Contains(messages[1], "connect") ||
+			strings.Contains(messages[0], "RECEIVED AT") {
+			t.Errorf("failed exchange must be printed with its error\n%v", messages)
+		}
+
+		New("http://127.0.0.1:1").SetDebug(true).SetDebugOptions(DebugOptions{Format: DebugJSON, Logger: NewWriterDebugLogger(&buffer)}).Get().Do()
+		var record DebugRecord
+		if err := json.NewDecoder(&buffer).Decode(&record); err != nil || record.Error == "" || record.StatusCode != 0 || record.ReceivedAt != nil {
+			t.Errorf("invalid failed record %+v %v", record, err)
+		}
+	})
+}
+
+func TestMatchJSONPath(t *testing.T) {
+	cases := []struct {
+		pattern, path string
+		expected      bool
+	}{
+		{"password", "user.password", true},
+		{"PASSWORD", "password", true},
+		{"user.password", "password", false},
+		{"user.*", "user.name", true},
+		{"items.*.token", "items.3.token", true},
+		{"items.*.token", "items.3.name", false},
+	}
+	for _, c := range cases {
+		if actual := matchJSONPath(strings.Split(c.pattern, "."), strings.Split(c.path, ".")); actual != c.expected {
+			t.Errorf("invalid match of %s on %s\n\tExpected : %v\n\tActual : %v", c.pattern, c.path, c.expected, actual)
+		}
+	}
+}
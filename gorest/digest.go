@@ -0,0 +1,352 @@
+package bunker
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// SetDigestAuth answers RFC 7616 Digest challenges of the request host. The
+// answered challenges are kept in cache so later requests under the same
+// directory are authorized up front, a nil cache is only used by this
+// requester and its clones.
+func (base *Requester) SetDigestAuth(username, password string, cache *DigestCache) *Requester {
+	if cache == nil {
+		cache = NewDigestCache()
+	}
+	base.digestAuth = &DigestTransport{Username: username, Password: password, Cache: cache}
+	return base
+}
+
+// withDigestAuth wraps the transport of client, which must be a copy owned by
+// the requester.
+func (base *Requester) withDigestAuth(client *http.Client) *http.Client {
+	if base.digestAuth != nil {
+		digest := *base.digestAuth
+		digest.Base = client.Transport
+		digest.Host = base.Request.URL.Host
+		client.Transport = &digest
+	}
+	return client
+}
+
+// DigestTransport authorizes the requests of Base with Digest authentication,
+// MD5, SHA-256 and their -sess variants with qop=auth are supported. A 401
+// challenge is answered once, which needs the body to be replayable through
+// Request.GetBody.
+type DigestTransport struct {
+	Base     http.RoundTripper
+	Username string
+	Password string
+	// Host limits the answered challenges to one host:port, empty answers
+	// every host.
+	Host string
+	// Cache keeps the answered challenges, nil answers every challenge
+	// again.
+	Cache *DigestCache
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       bool
+	userhash  bool
+	count     int
+}
+
+// DigestCache keeps the challenges answered for a set of credentials, by host
+// and realm. A request is authorized up front when its path is under the
+// directory of a request that was challenged before.
+type DigestCache struct {
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge
+	// spaces maps host and directory to the realm that protects it
+	spaces map[string]string
+}
+
+func NewDigestCache() *DigestCache {
+	return &DigestCache{
+		challenges: make(map[string]*digestChallenge),
+		spaces:     make(map[string]string),
+	}
+}
+
+func (cache *DigestCache) store(req *http.Request, challenge *digestChallenge) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.challenges[req.URL.Host+" "+challenge.realm] = challenge
+	cache.spaces[req.URL.Host+" "+path.Dir(req.URL.EscapedPath())] = challenge.realm
+}
+
+// next returns the challenge protecting req with its next nonce count.
+func (cache *DigestCache) next(req *http.Request) (digestChallenge, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for dir := path.Dir(req.URL.EscapedPath()); ; dir = path.Dir(dir) {
+		if realm, ok := cache.spaces[req.URL.Host+" "+dir]; ok {
+			challenge, ok := cache.challenges[req.URL.Host+" "+realm]
+			if !ok {
+				return digestChallenge{}, false
+			}
+			challenge.count++
+			return *challenge, true
+		}
+		if dir == "/" || dir == "." {
+			return digestChallenge{}, false
+		}
+	}
+}
+
+// updateNonce follows the nextnonce of an Authentication-Info header.
+func (cache *DigestCache) updateNonce(req *http.Request, realm string, response *http.Response) {
+	if response == nil {
+		return
+	}
+	info := parseAuthParams(response.Header.Get("Authentication-Info"))
+	if info["nextnonce"] == "" {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if challenge, ok := cache.challenges[req.URL.Host+" "+realm]; ok {
+		challenge.nonce, challenge.count = info["nextnonce"], 0
+	}
+}
+
+func (transport *DigestTransport) cache() *DigestCache {
+	if transport.Cache == nil {
+		return NewDigestCache()
+	}
+	return transport.Cache
+}
+
+func (transport *DigestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if transport.Host != "" && !strings.EqualFold(transport.Host, req.URL.Host) {
+		return base.RoundTrip(req)
+	}
+	cache := transport.cache()
+
+	sent := req
+	challenge, cached := cache.next(req)
+	if cached {
+		sent = req.Clone(req.Context())
+		sent.Header.Set(Auth, transport.authorization(&challenge, req))
+	}
+	response, err := base.RoundTrip(sent)
+	if err != nil || response.StatusCode != http.StatusUnauthorized {
+		if cached {
+			cache.updateNonce(req, challenge.realm, response)
+		}
+		return response, err
+	}
+
+	fresh := parseDigestChallenge(response.Header.Values("WWW-Authenticate"))
+	if fresh == nil {
+		return response, nil
+	}
+	retry := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return response, nil
+		}
+		body, errBody := req.GetBody()
+		if errBody != nil {
+			return response, nil
+		}
+		retry.Body = body
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+	response.Body.Close()
+
+	cache.store(req, fresh)
+	challenge, _ = cache.next(req)
+	retry.Header.Set(Auth, transport.authorization(&challenge, retry))
+	response, err = base.RoundTrip(retry)
+	cache.updateNonce(req, challenge.realm, response)
+	return response, err
+}
+
+func (transport *DigestTransport) authorization(challenge *digestChallenge, req *http.Request) string {
+	h := challenge.hash()
+	uri := req.URL.RequestURI()
+	ha1 := h(transport.Username + ":" + challenge.realm + ":" + transport.Password)
+	cnonce := newCnonce()
+	nc := fmt.Sprintf("%08x", challenge.count)
+	if strings.HasSuffix(challenge.algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + challenge.nonce + ":" + cnonce)
+	}
+	ha2 := h(req.Method + ":" + uri)
+
+	username := transport.Username
+	if challenge.userhash {
+		username = h(transport.Username + ":" + challenge.realm)
+	}
+	params := []string{
+		"username=" + quoteParam(username),
+		"realm=" + quoteParam(challenge.realm),
+		"nonce=" + quoteParam(challenge.nonce),
+		"uri=" + quoteParam(uri),
+		"algorithm=" + challenge.algorithm,
+	}
+	if challenge.qop {
+		response := h(ha1 + ":" + challenge.nonce + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+		params = append(params, "response="+quoteParam(response), "qop=auth", "nc="+nc, "cnonce="+quoteParam(cnonce))
+	} else {
+		params = append(params, "response="+quoteParam(h(ha1+":"+challenge.nonce+":"+ha2)))
+	}
+	if challenge.opaque != "" {
+		params = append(params, "opaque="+quoteParam(challenge.opaque))
+	}
+	if challenge.userhash {
+		params = append(params, "userhash=true")
+	}
+	return "Digest " + strings.Join(params, ", ")
+}
+
+func (challenge *digestChallenge) hash() func(string) string {
+	newHash := md5.New
+	if strings.HasPrefix(challenge.algorithm, "SHA-256") {
+		newHash = sha256.New
+	}
+	return func(data string) string {
+		digest := newHash()
+		digest.Write([]byte(data))
+		return hex.EncodeToString(digest.Sum(nil))
+	}
+}
+
+// parseDigestChallenge picks the strongest supported Digest challenge, nil
+// when there is none.
+func parseDigestChallenge(headers []string) *digestChallenge {
+	var best *digestChallenge
+	for _, header := range headers {
+		for _, params := range splitChallenges(header) {
+			if params == nil {
+				continue
+			}
+			algorithm := strings.ToUpper(params["algorithm"])
+			if algorithm == "" {
+				algorithm = "MD5"
+			}
+			switch algorithm {
+			case "MD5", "MD5-SESS", "SHA-256", "SHA-256-SESS":
+			default:
+				continue
+			}
+			challenge := &digestChallenge{
+				realm:     params["realm"],
+				nonce:     params["nonce"],
+				opaque:    params["opaque"],
+				algorithm: algorithm,
+				userhash:  strings.EqualFold(params["userhash"], "true"),
+			}
+			if qop, ok := params["qop"]; ok {
+				for _, option := range strings.Split(qop, ",") {
+					challenge.qop = challenge.qop || strings.EqualFold(strings.TrimSpace(option), "auth")
+				}
+				if !challenge.qop {
+					continue
+				}
+			}
+			if best == nil || strings.HasPrefix(algorithm, "SHA-256") && !strings.HasPrefix(best.algorithm, "SHA-256") {
+				best = challenge
+			}
+		}
+	}
+	return best
+}
+
+// splitChallenges returns the parameters of every Digest challenge of a
+// WWW-Authenticate header, other schemes are returned as nil.
+func splitChallenges(header string) []map[string]string {
+	var challenges []map[string]string
+	var current map[string]string
+	for _, part := range splitAuthParams(header) {
+		scheme, rest := part, ""
+		if i := strings.IndexAny(part, " \t"); i >= 0 && !strings.Contains(part[:i], "=") {
+			scheme, rest = part[:i], strings.TrimSpace(part[i+1:])
+		} else if strings.Contains(part, "=") {
+			if current != nil {
+				addAuthParam(current, part)
+			}
+			continue
+		}
+		current = nil
+		if strings.EqualFold(scheme, "Digest") {
+			current = make(map[string]string)
+		}
+		challenges = append(challenges, current)
+		if current != nil && rest != "" {
+			addAuthParam(current, rest)
+		}
+	}
+	return challenges
+}
+
+func parseAuthParams(header string) map[string]string {
+	params := make(map[string]string)
+	for _, part := range splitAuthParams(header) {
+		addAuthParam(params, part)
+	}
+	return params
+}
+
+func addAuthParam(params map[string]string, part string) {
+	name, value, ok := strings.Cut(part, "=")
+	if !ok {
+		return
+	}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) && len(value) > 1 {
+		value = strings.NewReplacer(`\\`, `\`, `\"`, `"`).Replace(value[1 : len(value)-1])
+	}
+	params[strings.ToLower(strings.TrimSpace(name))] = value
+}
+
+// splitAuthParams splits on the commas outside of quoted strings.
+func splitAuthParams(header string) []string {
+	var parts []string
+	start, quoted, escaped := 0, false, false
+	for i := 0; i < len(header); i++ {
+		switch c := header[i]; {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			if part := strings.TrimSpace(header[start:i]); part != "" {
+				parts = append(parts, part)
+			}
+			start = i + 1
+		}
+	}
+	if part := strings.TrimSpace(header[start:]); part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+func quoteParam(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func newCnonce() string {
+	data := make([]byte, 16)
+	_, _ = rand.Read(data)
+	return hex.EncodeToString(data)
+}
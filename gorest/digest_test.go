@@ -0,0 +1,138 @@
+package bunker
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type digestServer struct {
+	algorithm string
+	password  string
+
+	mu         sync.Mutex
+	challenges int
+	counts     []string
+}
+
+func (server *digestServer) hash(data string) string {
+	if server.algorithm == "SHA-256" {
+		sum := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+	sum := md5.Sum([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func (server *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	params := parseAuthParams(strings.TrimPrefix(r.Header.Get(Auth), "Digest "))
+	realm := "appliance"
+	if strings.HasPrefix(r.URL.Path, "/admin/") {
+		realm = "admin"
+	}
+	ha1 := server.hash("user:" + realm + ":" + server.password)
+	ha2 := server.hash(r.Method + ":" + r.URL.RequestURI())
+	expected := server.hash(ha1 + ":nonce-1:" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+	if params["response"] != expected || params["uri"] != r.URL.RequestURI() || params["opaque"] != "opaque-1" {
+		server.challenges++
+		w.Header().Add("WWW-Authenticate", `Basic realm="appliance"`)
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", qop="auth,auth-int", algorithm=%s, nonce="nonce-1", opaque="opaque-1"`, realm, server.algorithm))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	server.counts = append(server.counts, params["nc"])
+	body, _ := io.ReadAll(r.Body)
+	_, _ = io.WriteString(w, "ok "+string(body))
+}
+
+func TestDigestAuth(t *testing.T) {
+	body := func(req *Requester) string {
+		if req.Response == nil {
+			return ""
+		}
+		data, _ := io.ReadAll(req.Response.Body)
+		return string(data)
+	}
+
+	t.Run("testSHA256ReplaysBody", func(t *testing.T) {
+		handler := &digestServer{algorithm: "SHA-256", password: "secret"}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		req := New(server.URL).AddPath("config").SetDigestAuth("user", "secret", nil).Post().SetPayload(map[string]interface{}{"mode": "night"}).Do()
+		if got := body(req); got != `ok {"mode":"night"}` {
+			t.Errorf("invalid response\n\tExpected : %v\n\tActual : %v", `ok {"mode":"night"}`, got)
+		}
+	})
+
+	t.Run("testNonceCachedPerHost", func(t *testing.T) {
+		handler := &digestServer{algorithm: "MD5", password: "secret"}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		cache := NewDigestCache()
+		for i := 0; i < 3; i++ {
+			if req := New(server.URL).AddPath("snapshot").Query("size=small").SetDigestAuth("user", "secret", cache).Get().Do(); req.Response.StatusCode != http.StatusOK {
+				t.Fatalf("invalid status %v", req.Response.StatusCode)
+			}
+		}
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		if handler.challenges != 1 {
+			t.Errorf("invalid challenges\n\tExpected : %v\n\tActual : %v", 1, handler.challenges)
+		}
+		if counts := strings.Join(handler.counts, ","); counts != "00000001,00000002,00000003" {
+			t.Errorf("invalid nonce counts %v", counts)
+		}
+	})
+
+	t.Run("testRealmsPerDirectory", func(t *testing.T) {
+		handler := &digestServer{algorithm: "MD5", password: "secret"}
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		cache := NewDigestCache()
+		for _, path := range []string{"v1/a", "admin/a", "v1/b", "admin/b", "other"} {
+			if req := New(server.URL).AddPath(path).SetDigestAuth("user", "secret", cache).Get().Do(); req.Response.StatusCode != http.StatusOK {
+				t.Fatalf("invalid status %v", req.Response.StatusCode)
+			}
+		}
+		handler.mu.Lock()
+		defer handler.mu.Unlock()
+		if handler.challenges != 3 {
+			t.Errorf("invalid challenges\n\tExpected : %v\n\tActual : %v", 3, handler.challenges)
+		}
+	})
+
+	t.Run("testWrongPassword", func(t *testing.T) {
+		server := httptest.NewServer(&digestServer{algorithm: "SHA-256", password: "secret"})
+		defer server.Close()
+
+		req := New(server.URL).SetDigestAuth("user", "wrong", nil).Get().Do()
+		if req.Response == nil || req.Response.StatusCode != http.StatusUnauthorized {
+			t.Errorf("wrong credentials must return the challenge")
+		}
+	})
+
+	t.Run("testParseChallenge", func(t *testing.T) {
+		challenge := parseDigestChallenge([]string{
+			`Digest realm="a, b", qop="auth", algorithm=MD5, nonce="n1"`,
+			`Basic realm="x", Digest realm="a, b", qop="auth", algorithm=SHA-256, nonce="n2", userhash=true`,
+		})
+		if challenge == nil || challenge.algorithm != "SHA-256" || challenge.realm != "a, b" || challenge.nonce != "n2" || !challenge.userhash {
+			t.Errorf("invalid challenge %+v", challenge)
+		}
+		if challenge := parseDigestChallenge([]string{`Digest realm="a", qop="auth-int", nonce="n"`}); challenge != nil {
+			t.Errorf("auth-int only challenges are not supported")
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package bunker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestError holds every error a requester collected.
+type RequestError struct {
+	Errors []error
+}
+
+func (e *RequestError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *RequestError) Unwrap() []error {
+	return e.Errors
+}
+
+// Is and As make errors.Is and errors.As look into every collected error on
+// Go versions that do not follow Unwrap() []error yet.
+func (e *RequestError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *RequestError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns nil or a *RequestError wrapping every collected error.
+func (base *Requester) Err() error {
+	if !base.HaveError() {
+		return nil
+	}
+	return &RequestError{Errors: append([]error(nil), base.Errors...)}
+}
+
+// StatusError is returned by the typed functions for a non 2xx response.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %s", e.Status)
+}
+
+// Response is a response whose body was read into Body.
+type Response struct {
+	*http.Response
+	Body []byte
+}
+
+// Option configures the requester behind a typed call, any Requester setter
+// can be wrapped in one.
+type Option func(req *Requester) *Requester
+
+func WithHeader(param string, values ...string) Option {
+	return func(req *Requester) *Requester { return req.SetHeader(param, values...) }
+}
+
+func WithToken(token string) Option {
+	return func(req *Requester) *Requester { return req.SetToken(token) }
+}
+
+func WithAuthProvider(provider AuthProvider) Option {
+	return func(req *Requester) *Requester { return req.SetAuthProvider(provider) }
+}
+
+func WithBasicAuth(username, password string) Option {
+	return func(req *Requester) *Requester { return req.SetBasicAuth(username, password) }
+}
+
+func WithQuery(query interface{}) Option {
+	return func(req *Requester) *Requester { return req.Query(query) }
+}
+
+func WithPathParam(name, value string) Option {
+	return func(req *Requester) *Requester { return req.PathParam(name, value) }
+}
+
+func WithContentType(contentType string) Option {
+	return func(req *Requester) *Requester { return req.SetContentType(contentType) }
+}
+
+func WithTimeout(timeOut time.Duration) Option {
+	return func(req *Requester) *Requester { return req.SetTimeout(timeOut) }
+}
+
+func WithDebug(debug bool) Option {
+	return func(req *Requester) *Requester { return req.SetDebug(debug) }
+}
+
+// Do sends req and decodes a 2xx body into T with the codec of the response,
+// a []byte or string T receives the raw body.
+func Do[T any](req *Requester) (T, *Response, error) {
+	var result T
+	if err := req.Do().Err(); err != nil {
+		return result, nil, err
+	}
+
+	body := req.readAll(req.Response.Body)
+	req.Response.Body.Close()
+	req.Response.Body = nopCloser(body)
+	if err := req.Err(); err != nil {
+		return result, nil, err
+	}
+	response := &Response{Response: req.Response, Body: body}
+
+	if req.Response.StatusCode < http.StatusOK || req.Response.StatusCode >= http.StatusMultipleChoices {
+		return result, response, &StatusError{StatusCode: req.Response.StatusCode, Status: req.Response.Status, Body: body}
+	}
+	if len(body) == 0 || req.Response.StatusCode == http.StatusNoContent {
+		return result, response, nil
+	}
+	switch target := interface{}(&result).(type) {
+	case *[]byte:
+		*target = body
+		return result, response, nil
+	case *string:
+		*target = string(body)
+		return result, response, nil
+	}
+	err := req.Decode(&result).Err()
+	return result, response, err
+}
+
+func typed[T any](ctx context.Context, client *http.Client, method, url string, payload interface{}, opts []Option) (T, *Response, error) {
+	req := New(url).SetContext(ctx).SetClient(client).SetAccept(Json)
+	req.Method = method
+	if payload != nil {
+		req.SetPayload(payload)
+	}
+	for _, opt := range opts {
+		req = opt(req)
+	}
+	return Do[T](req)
+}
+
+// GetJSON sends a GET request, client may be nil for a client per request.
+func GetJSON[T any](ctx context.Context, client *http.Client, url string, opts ...Option) (T, *Response, error) {
+	return typed[T](ctx, client, GET, url, nil, opts)
+}
+
+func PostJSON[T any](ctx context.Context, client *http.Client, url string, payload interface{}, opts ...Option) (T, *Response, error) {
+	return typed[T](ctx, client, POST, url, payload, opts)
+}
+
+func PutJSON[T any](ctx context.Context, client *http.Client, url string, payload interface{}, opts ...Option) (T, *Response, error) {
+	return typed[T](ctx, client, PUT, url, payload, opts)
+}
+
+func PatchJSON[T any](ctx context.Context, client *http.Client, url string, payload interface{}, opts ...Option) (T, *Response, error) {
+	return typed[T](ctx, client, PATCH, url, payload, opts)
+}
+
+func DeleteJSON[T any](ctx context.Context, client *http.Client, url string, opts ...Option) (T, *Response, error) {
+	return typed[T](ctx, client, DELETE, url, nil, opts)
+}
@@ -0,0 +1,79 @@
+package bunker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type genericUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestTypedRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"message":"not found"}`)
+		case r.Method == DELETE:
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == POST:
+			var user genericUser
+			_ = json.NewDecoder(r.Body).Decode(&user)
+			user.ID = 2
+			_ = json.NewEncoder(w).Encode(user)
+		default:
+			_ = json.NewEncoder(w).Encode(genericUser{ID: 1, Name: r.Header.Get(Auth) + r.URL.Query().Get("q")})
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	t.Run("testGetJSON", func(t *testing.T) {
+		user, response, err := GetJSON[genericUser](ctx, server.Client(), server.URL+"/users/1", WithToken("x"), WithQuery("q=y"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != 1 || user.Name != Bearer+"xy" || response.StatusCode != http.StatusOK || len(response.Body) == 0 {
+			t.Errorf("invalid response %+v", user)
+		}
+	})
+
+	t.Run("testPostJSON", func(t *testing.T) {
+		user, _, err := PostJSON[genericUser](ctx, nil, server.URL, genericUser{Name: "new"})
+		if err != nil || user.ID != 2 || user.Name != "new" {
+			t.Errorf("invalid response %+v %v", user, err)
+		}
+	})
+
+	t.Run("testDeleteNoContent", func(t *testing.T) {
+		_, response, err := DeleteJSON[struct{}](ctx, nil, server.URL+"/users/1")
+		if err != nil || response.StatusCode != http.StatusNoContent {
+			t.Errorf("invalid response %v", err)
+		}
+	})
+
+	t.Run("testStatusError", func(t *testing.T) {
+		raw, response, err := GetJSON[string](ctx, nil, server.URL+"/missing")
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound || response == nil || raw != "" {
+			t.Errorf("invalid status error %v", err)
+		}
+	})
+
+	t.Run("testAccumulatedErrors", func(t *testing.T) {
+		_, _, err := GetJSON[genericUser](ctx, nil, server.URL, WithHeader("a"), func(req *Requester) *Requester {
+			return req.SetHeaders(42).Query(42)
+		})
+		var requestErr *RequestError
+		if !errors.As(err, &requestErr) || len(requestErr.Errors) != 2 {
+			t.Errorf("invalid request error %v", err)
+		}
+	})
+}
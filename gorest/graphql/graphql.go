@@ -0,0 +1,183 @@
+package bunker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	gorest "github.com/yudhiana/bunker/gorest"
+)
+
+const GraphQLResponse string = "application/graphql-response+json"
+
+// Request is a GraphQL operation, Variables is marshaled to JSON as is so it
+// can be a typed struct.
+type Request struct {
+	Query         string      `json:"query,omitempty"`
+	Variables     interface{} `json:"variables,omitempty"`
+	OperationName string      `json:"operationName,omitempty"`
+	Extensions    interface{} `json:"extensions,omitempty"`
+}
+
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error is one entry of the errors list of a GraphQL response.
+type Error struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []Location             `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	path := make([]string, len(e.Path))
+	for i, segment := range e.Path {
+		path[i] = fmt.Sprint(segment)
+	}
+	return fmt.Sprintf("%s (path %s)", e.Message, strings.Join(path, "."))
+}
+
+// Code returns extensions.code, the error code most servers use.
+func (e *Error) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// Errors is returned when the response carries errors, even with status 200.
+// Data that was returned alongside the errors is still decoded.
+type Errors []*Error
+
+func (errs Errors) Error() string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+// StatusError is returned for a non 2xx response without GraphQL errors.
+type StatusError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("graphql: unexpected status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+type response struct {
+	Data   json.RawMessage `json:"data"`
+	Errors Errors          `json:"errors"`
+}
+
+// Client sends GraphQL operations over HTTP POST.
+type Client struct {
+	endpoint  string
+	prepare   []func(req *gorest.Requester)
+	persisted bool
+}
+
+func New(endpoint string) *Client {
+	return &Client{endpoint: endpoint}
+}
+
+// Use configures every requester the client creates, e.g. to set a token.
+func (c *Client) Use(prepare func(req *gorest.Requester)) *Client {
+	c.prepare = append(c.prepare, prepare)
+	return c
+}
+
+// UsePersistedQueries sends only the sha256 hash of the query first and the
+// full query when the server does not know the hash yet.
+func (c *Client) UsePersistedQueries(enabled bool) *Client {
+	c.persisted = enabled
+	return c
+}
+
+// Do executes request and decodes data into target, which may be nil.
+func (c *Client) Do(ctx context.Context, request Request, target interface{}) error {
+	if !c.persisted {
+		return c.send(ctx, request, target)
+	}
+
+	hash := sha256.Sum256([]byte(request.Query))
+	persisted := request
+	persisted.Query = ""
+	persisted.Extensions = map[string]interface{}{
+		"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": hex.EncodeToString(hash[:])},
+	}
+	err := c.send(ctx, persisted, target)
+	if !isPersistedQueryNotFound(err) {
+		return err
+	}
+	persisted.Query = request.Query
+	return c.send(ctx, persisted, target)
+}
+
+func (c *Client) send(ctx context.Context, request Request, target interface{}) error {
+	req := gorest.New(c.endpoint).Post()
+	for _, prepare := range c.prepare {
+		prepare(req)
+	}
+	req.SetContext(ctx).SetContentType(gorest.Json).SetAccept(GraphQLResponse, gorest.Json).SetPayload(request).Do()
+
+	var result response
+	if !req.HaveError() {
+		req.Decode(&result)
+	}
+	if req.HaveError() {
+		if req.Response != nil && req.Response.StatusCode >= http.StatusMultipleChoices {
+			return statusError(req.Response)
+		}
+		return fmt.Errorf("graphql: %w", req.Err())
+	}
+
+	if target != nil && len(result.Data) > 0 && string(result.Data) != "null" {
+		if err := json.Unmarshal(result.Data, target); err != nil {
+			return err
+		}
+	}
+	if len(result.Errors) > 0 {
+		return result.Errors
+	}
+	if req.Response.StatusCode >= http.StatusMultipleChoices {
+		return statusError(req.Response)
+	}
+	return nil
+}
+
+func statusError(response *http.Response) error {
+	body, _ := io.ReadAll(response.Body)
+	return &StatusError{StatusCode: response.StatusCode, Body: body}
+}
+
+func isPersistedQueryNotFound(err error) bool {
+	errs, isErrors := err.(Errors)
+	if !isErrors {
+		return false
+	}
+	for _, e := range errs {
+		if e.Message == "PersistedQueryNotFound" || e.Code() == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute runs request and returns data decoded as T.
+func Execute[T any](ctx context.Context, client *Client, request Request) (T, error) {
+	var data T
+	err := client.Do(ctx, request, &data)
+	return data, err
+}
@@ -0,0 +1,114 @@
+package bunker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gorest "github.com/yudhiana/bunker/gorest"
+)
+
+type user struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userData struct {
+	User *user `json:"user"`
+}
+
+type userVariables struct {
+	ID string `json:"id"`
+}
+
+func TestGraphQL(t *testing.T) {
+	var received []Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request Request
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		received = append(received, request)
+		w.Header().Set("Content-Type", GraphQLResponse)
+
+		switch {
+		case r.Header.Get(gorest.Auth) != gorest.Bearer+"token":
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = io.WriteString(w, `unauthorized`)
+		case request.Extensions != nil && request.Query == "":
+			_, _ = io.WriteString(w, `{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`)
+		case request.OperationName == "Broken":
+			_, _ = io.WriteString(w, `{"data":{"user":{"id":"1","name":"a"}},"errors":[{"message":"name hidden","path":["user","name"],"locations":[{"line":2,"column":3}],"extensions":{"code":"FORBIDDEN"}}]}`)
+		default:
+			_, _ = io.WriteString(w, `{"data":{"user":{"id":"1","name":"a"}}}`)
+		}
+	}))
+	defer server.Close()
+
+	client := New(server.URL).Use(func(req *gorest.Requester) {
+		req.SetToken("token")
+	})
+	query := `query User($id: ID!) { user(id: $id) { id name } }`
+
+	t.Run("testTypedData", func(t *testing.T) {
+		data, err := Execute[userData](context.Background(), client, Request{
+			Query: query, Variables: userVariables{ID: "1"}, OperationName: "User",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.User == nil || data.User.Name != "a" {
+			t.Errorf("invalid data %+v", data)
+		}
+		variables, _ := received[len(received)-1].Variables.(map[string]interface{})
+		if variables["id"] != "1" {
+			t.Errorf("invalid variables %v", received[len(received)-1].Variables)
+		}
+	})
+
+	t.Run("testErrorsWithStatusOK", func(t *testing.T) {
+		var data userData
+		err := client.Do(context.Background(), Request{Query: query, OperationName: "Broken"}, &data)
+		var errs Errors
+		if !errors.As(err, &errs) || len(errs) != 1 {
+			t.Fatalf("invalid errors %v", err)
+		}
+		e := errs[0]
+		if e.Code() != "FORBIDDEN" || len(e.Path) != 2 || e.Locations[0].Line != 2 {
+			t.Errorf("invalid error %+v", e)
+		}
+		if data.User == nil {
+			t.Error("partial data must be decoded")
+		}
+	})
+
+	t.Run("testPersistedQuery", func(t *testing.T) {
+		received = nil
+		_, err := Execute[userData](context.Background(), New(server.URL).UsePersistedQueries(true).Use(func(req *gorest.Requester) {
+			req.SetToken("token")
+		}), Request{Query: query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(received) != 2 || received[0].Query != "" || received[1].Query != query {
+			t.Fatalf("invalid persisted query flow %+v", received)
+		}
+		hash := received[1].Extensions.(map[string]interface{})["persistedQuery"].(map[string]interface{})["sha256Hash"]
+		expected := sha256.Sum256([]byte(query))
+		if hash != hex.EncodeToString(expected[:]) {
+			t.Errorf("invalid hash\n\tExpected : %x\n\tActual : %v", expected, hash)
+		}
+	})
+
+	t.Run("testStatusError", func(t *testing.T) {
+		_, err := Execute[userData](context.Background(), New(server.URL), Request{Query: query})
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized || string(statusErr.Body) != "unauthorized" {
+			t.Errorf("invalid status error %v", err)
+		}
+	})
+}
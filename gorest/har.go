@@ -0,0 +1,498 @@
+package bunker
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultHARBodySize caps the recorded request and response bodies.
+	DefaultHARBodySize = 64 << 10
+	Redacted           = "[REDACTED]"
+)
+
+// DefaultRedactedHeaders are redacted when HAROptions.RedactHeaders is nil.
+var DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", IdempotencyKeyHeader}
+
+type HAROptions struct {
+	// MaxBodySize defaults to DefaultHARBodySize, a negative value records no body.
+	MaxBodySize int
+	// RedactHeaders lists header names whose values are replaced, cookies are
+	// redacted with the Cookie and Set-Cookie headers.
+	RedactHeaders []string
+	// RedactFields lists JSON fields and query parameters whose values are
+	// replaced, matched case-insensitively at any depth.
+	RedactFields []string
+}
+
+// HARRecorder collects the exchanges of every requester it is set on into a
+// HAR 1.2 log, it is safe for concurrent use.
+type HARRecorder struct {
+	mu      sync.Mutex
+	options HAROptions
+	headers map[string]bool
+	fields  map[string]bool
+	entries []*HAREntry
+}
+
+func NewHARRecorder(options HAROptions) *HARRecorder {
+	if options.MaxBodySize == 0 {
+		options.MaxBodySize = DefaultHARBodySize
+	}
+	if options.RedactHeaders == nil {
+		options.RedactHeaders = DefaultRedactedHeaders
+	}
+	recorder := &HARRecorder{options: options, headers: make(map[string]bool), fields: make(map[string]bool)}
+	for _, header := range options.RedactHeaders {
+		recorder.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	for _, field := range options.RedactFields {
+		recorder.fields[strings.ToLower(field)] = true
+	}
+	return recorder
+}
+
+// SetHARRecorder records every exchange of Do into recorder.
+func (base *Requester) SetHARRecorder(recorder *HARRecorder) *Requester {
+	base.har = recorder
+	return base
+}
+
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator HARCreator  `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type HARContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are in milliseconds, -1 marks a phase that did not happen.
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// HAR returns a copy of the recorded log.
+func (recorder *HARRecorder) HAR() HAR {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	entries := make([]*HAREntry, len(recorder.entries))
+	for i, entry := range recorder.entries {
+		copied := *entry
+		entries[i] = &copied
+	}
+	return HAR{Log: HARLog{Version: "1.2", Creator: HARCreator{Name: "gorest", Version: "1.0"}, Entries: entries}}
+}
+
+func (recorder *HARRecorder) Reset() {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.entries = nil
+}
+
+func (recorder *HARRecorder) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(recorder.HAR(), "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+func (recorder *HARRecorder) WriteFile(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = recorder.WriteTo(file)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+// harExchange follows one Do call, its methods do nothing on a nil value so
+// Do can call them whether recording is enabled or not.
+type harExchange struct {
+	recorder *HARRecorder
+	entry    *HAREntry
+	started  time.Time
+	payload  []byte
+
+	mu                       sync.Mutex
+	getConn, gotConn         time.Time
+	dnsStart, dnsDone        time.Time
+	connectStart, connectEnd time.Time
+	tlsStart, tlsDone        time.Time
+	wroteRequest, firstByte  time.Time
+}
+
+func (base *Requester) harStart() *harExchange {
+	if base.har == nil {
+		return nil
+	}
+	exchange := &harExchange{recorder: base.har, entry: &HAREntry{}, started: time.Now(), payload: base.payload}
+	lock := func(set func()) {
+		exchange.mu.Lock()
+		set()
+		exchange.mu.Unlock()
+	}
+	trace := &httptrace.ClientTrace{
+		GetConn:              func(string) { lock(func() { exchange.getConn = time.Now() }) },
+		GotConn:              func(httptrace.GotConnInfo) { lock(func() { exchange.gotConn = time.Now() }) },
+		DNSStart:             func(httptrace.DNSStartInfo) { lock(func() { exchange.dnsStart = time.Now() }) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { lock(func() { exchange.dnsDone = time.Now() }) },
+		ConnectStart:         func(string, string) { lock(func() { exchange.connectStart = time.Now() }) },
+		ConnectDone:          func(string, string, error) { lock(func() { exchange.connectEnd = time.Now() }) },
+		TLSHandshakeStart:    func() { lock(func() { exchange.tlsStart = time.Now() }) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { lock(func() { exchange.tlsDone = time.Now() }) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { lock(func() { exchange.wroteRequest = time.Now() }) },
+		GotFirstResponseByte: func() { lock(func() { exchange.firstByte = time.Now() }) },
+	}
+	base.Request = base.Request.WithContext(httptrace.WithClientTrace(base.Request.Context(), trace))
+	return exchange
+}
+
+// fail records an exchange that got no response.
+func (exchange *harExchange) fail(request *http.Request, err error) {
+	if exchange == nil {
+		return
+	}
+	exchange.request(request)
+	exchange.entry.Response = HARResponse{Cookies: []HARCookie{}, Headers: []HARNameValue{}, HeadersSize: -1, BodySize: -1}
+	exchange.entry.Comment = err.Error()
+	exchange.complete(time.Now())
+}
+
+// finish records the response once its body is read or closed, the request
+// of the response is the last one sent and carries the cookies of the jar.
+func (exchange *harExchange) finish(request *http.Request, response *http.Response) {
+	if exchange == nil {
+		return
+	}
+	if response.Request != nil {
+		request = response.Request
+	}
+	exchange.request(request)
+	recorder := exchange.recorder
+	exchange.entry.Response = HARResponse{
+		Status:      response.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(response.Status, strconv.Itoa(response.StatusCode))),
+		HTTPVersion: response.Proto,
+		Cookies:     recorder.cookies(response.Cookies()),
+		Headers:     recorder.headerList(response.Header),
+		Content:     HARContent{MimeType: response.Header.Get("Content-Type")},
+		RedirectURL: response.Header.Get("Location"),
+		HeadersSize: -1,
+	}
+	if response.Body == nil || response.Body == http.NoBody {
+		exchange.complete(time.Now())
+		return
+	}
+	response.Body = &harBody{ReadCloser: response.Body, exchange: exchange}
+}
+
+func (exchange *harExchange) request(request *http.Request) {
+	recorder := exchange.recorder
+	query := request.URL.Query()
+	queryString := []HARNameValue{}
+	for _, name := range sortedKeys(query) {
+		for _, value := range query[name] {
+			if recorder.fields[strings.ToLower(name)] {
+				value = Redacted
+			}
+			queryString = append(queryString, HARNameValue{Name: name, Value: value})
+		}
+	}
+	clean := *request.URL
+	clean.User = nil
+	if len(recorder.fields) > 0 && clean.RawQuery != "" {
+		redacted := url.Values{}
+		for _, pair := range queryString {
+			redacted.Add(pair.Name, pair.Value)
+		}
+		clean.RawQuery = redacted.Encode()
+	}
+
+	exchange.entry.StartedDateTime = exchange.started.Format(time.RFC3339Nano)
+	exchange.entry.Request = HARRequest{
+		Method:      request.Method,
+		URL:         clean.String(),
+		HTTPVersion: request.Proto,
+		Cookies:     recorder.cookies(request.Cookies()),
+		Headers:     recorder.headerList(request.Header),
+		QueryString: queryString,
+		HeadersSize: -1,
+		BodySize:    len(exchange.payload),
+	}
+	if exchange.payload != nil {
+		text, comment := recorder.body(exchange.payload, request.Header.Get("Content-Type"))
+		exchange.entry.Request.PostData = &HARPostData{MimeType: request.Header.Get("Content-Type"), Text: text, Comment: comment}
+	}
+}
+
+func (exchange *harExchange) complete(receivedAt time.Time) {
+	exchange.mu.Lock()
+	timings := HARTimings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1}
+	if !exchange.dnsStart.IsZero() && !exchange.dnsDone.IsZero() {
+		timings.DNS = milliseconds(exchange.dnsDone.Sub(exchange.dnsStart))
+	}
+	if !exchange.connectStart.IsZero() && !exchange.connectEnd.IsZero() {
+		connected := exchange.connectEnd
+		if exchange.tlsDone.After(connected) {
+			connected = exchange.tlsDone
+		}
+		timings.Connect = milliseconds(connected.Sub(exchange.connectStart))
+	}
+	if !exchange.tlsStart.IsZero() && !exchange.tlsDone.IsZero() {
+		timings.SSL = milliseconds(exchange.tlsDone.Sub(exchange.tlsStart))
+	}
+	if !exchange.getConn.IsZero() && !exchange.gotConn.IsZero() {
+		blocked := exchange.gotConn.Sub(exchange.getConn)
+		for _, phase := range []float64{timings.DNS, timings.Connect} {
+			if phase > 0 {
+				blocked -= time.Duration(phase * float64(time.Millisecond))
+			}
+		}
+		if blocked > 0 {
+			timings.Blocked = milliseconds(blocked)
+		}
+	}
+	if !exchange.gotConn.IsZero() && !exchange.wroteRequest.IsZero() {
+		timings.Send = milliseconds(exchange.wroteRequest.Sub(exchange.gotConn))
+	}
+	if !exchange.wroteRequest.IsZero() && !exchange.firstByte.IsZero() {
+		timings.Wait = milliseconds(exchange.firstByte.Sub(exchange.wroteRequest))
+	}
+	if !exchange.firstByte.IsZero() {
+		timings.Receive = milliseconds(receivedAt.Sub(exchange.firstByte))
+	}
+	exchange.mu.Unlock()
+
+	exchange.entry.Timings = timings
+	for _, phase := range []float64{timings.Blocked, timings.DNS, timings.Connect, timings.Send, timings.Wait, timings.Receive} {
+		if phase > 0 {
+			exchange.entry.Time += phase
+		}
+	}
+
+	recorder := exchange.recorder
+	recorder.mu.Lock()
+	recorder.entries = append(recorder.entries, exchange.entry)
+	recorder.mu.Unlock()
+}
+
+// harBody keeps the first MaxBodySize bytes read and completes the entry at
+// EOF or Close, whichever comes first.
+type harBody struct {
+	io.ReadCloser
+	exchange *harExchange
+	captured bytes.Buffer
+	size     int
+	done     bool
+}
+
+func (body *harBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.size += n
+	if room := body.exchange.recorder.options.MaxBodySize - body.captured.Len(); room > 0 {
+		if n < room {
+			room = n
+		}
+		body.captured.Write(p[:room])
+	}
+	if err != nil {
+		body.complete()
+	}
+	return n, err
+}
+
+func (body *harBody) Close() error {
+	body.complete()
+	return body.ReadCloser.Close()
+}
+
+func (body *harBody) complete() {
+	if body.done {
+		return
+	}
+	body.done = true
+	exchange := body.exchange
+	content := &exchange.entry.Response.Content
+	content.Size = body.size
+	exchange.entry.Response.BodySize = body.size
+	content.Text, content.Comment = exchange.recorder.body(body.captured.Bytes(), content.MimeType)
+	if body.size > body.captured.Len() && content.Comment == "" && body.captured.Len() > 0 {
+		content.Comment = "truncated"
+	}
+	exchange.complete(time.Now())
+}
+
+// body returns the recordable text of a body and a comment on what was left out.
+func (recorder *HARRecorder) body(data []byte, contentType string) (string, string) {
+	if recorder.options.MaxBodySize < 0 || len(data) == 0 {
+		return "", ""
+	}
+	truncated := len(data) > recorder.options.MaxBodySize
+	if truncated {
+		data = data[:recorder.options.MaxBodySize]
+	}
+	if len(recorder.fields) > 0 && isJSONType(contentType) {
+		var document interface{}
+		if err := json.Unmarshal(data, &document); err != nil {
+			return "", "omitted, the JSON body could not be redacted"
+		}
+		data, _ = json.Marshal(recorder.redactJSON(document))
+	}
+	if !utf8.Valid(data) {
+		return "", "omitted, binary body"
+	}
+	if truncated {
+		return string(data), "truncated"
+	}
+	return string(data), ""
+}
+
+func (recorder *HARRecorder) redactJSON(document interface{}) interface{} {
+	switch document := document.(type) {
+	case map[string]interface{}:
+		for key, value := range document {
+			if recorder.fields[strings.ToLower(key)] {
+				document[key] = Redacted
+			} else {
+				document[key] = recorder.redactJSON(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range document {
+			document[i] = recorder.redactJSON(value)
+		}
+	}
+	return document
+}
+
+func (recorder *HARRecorder) headerList(header http.Header) []HARNameValue {
+	list := []HARNameValue{}
+	for _, name := range sortedKeys(header) {
+		for _, value := range header[name] {
+			if recorder.headers[http.CanonicalHeaderKey(name)] {
+				value = Redacted
+			}
+			list = append(list, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return list
+}
+
+func (recorder *HARRecorder) cookies(cookies []*http.Cookie) []HARCookie {
+	redact := recorder.headers["Cookie"] || recorder.headers["Set-Cookie"]
+	list := []HARCookie{}
+	for _, cookie := range cookies {
+		value := cookie.Value
+		if redact {
+			value = Redacted
+		}
+		harCookie := HARCookie{Name: cookie.Name, Value: value, Path: cookie.Path, Domain: cookie.Domain, HTTPOnly: cookie.HttpOnly, Secure: cookie.Secure}
+		if !cookie.Expires.IsZero() {
+			harCookie.Expires = cookie.Expires.Format(time.RFC3339)
+		}
+		list = append(list, harCookie)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func isJSONType(contentType string) bool {
+	mediaType := normalizeMediaType(contentType)
+	return mediaType == Json || strings.HasSuffix(mediaType, "+json")
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
@@ -0,0 +1,107 @@
+package bunker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHARRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "secret-session"})
+		w.Header().Set("Content-Type", Json)
+		switch r.URL.Path {
+		case "/large":
+			_, _ = io.WriteString(w, `"`+strings.Repeat("a", 100)+`"`)
+		default:
+			_, _ = io.WriteString(w, `{"user":{"name":"a","password":"hunter2"},"tokens":[{"token":"t1"}]}`)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("testEntry", func(t *testing.T) {
+		recorder := NewHARRecorder(HAROptions{RedactFields: []string{"password", "token", "api_key"}})
+		req := New(server.URL).AddPath("login").SetHARRecorder(recorder).SetToken("bearer-secret").
+			Query("api_key=k1&page=2").SetPayload(map[string]interface{}{"password": "p", "name": "a"}).Post().Do()
+		body, _ := io.ReadAll(req.Response.Body)
+		req.Response.Body.Close()
+
+		entries := recorder.HAR().Log.Entries
+		if len(entries) != 1 {
+			t.Fatalf("invalid entries\n\tExpected : %v\n\tActual : %v", 1, len(entries))
+		}
+		entry := entries[0]
+		if entry.Request.Method != POST || strings.Contains(entry.Request.URL, "k1") || entry.Request.QueryString[0].Value != Redacted {
+			t.Errorf("invalid request %+v", entry.Request)
+		}
+		for _, header := range entry.Request.Headers {
+			if header.Name == Auth && header.Value != Redacted {
+				t.Errorf("authorization must be redacted %v", header.Value)
+			}
+		}
+		if entry.Request.PostData == nil || strings.Contains(entry.Request.PostData.Text, `"p"`) {
+			t.Errorf("invalid post data %+v", entry.Request.PostData)
+		}
+		content := entry.Response.Content
+		if entry.Response.Status != http.StatusOK || entry.Response.StatusText != "OK" || content.Size != len(body) {
+			t.Errorf("invalid response %+v", entry.Response)
+		}
+		if strings.Contains(content.Text, "hunter2") || strings.Contains(content.Text, "t1") || !strings.Contains(content.Text, `"name":"a"`) {
+			t.Errorf("invalid redacted content %s", content.Text)
+		}
+		if len(entry.Response.Cookies) != 1 || entry.Response.Cookies[0].Value != Redacted {
+			t.Errorf("invalid cookies %+v", entry.Response.Cookies)
+		}
+		if entry.Timings.Wait < 0 || entry.Timings.Send < 0 || entry.Time <= 0 {
+			t.Errorf("invalid timings %+v", entry.Timings)
+		}
+	})
+
+	t.Run("testBodyCapAndFailure", func(t *testing.T) {
+		recorder := NewHARRecorder(HAROptions{MaxBodySize: 10})
+		req := New(server.URL).AddPath("large").SetHARRecorder(recorder).Get().Do()
+		_, _ = io.ReadAll(req.Response.Body)
+		New("http://127.0.0.1:1").SetHARRecorder(recorder).Get().Do()
+
+		entries := recorder.HAR().Log.Entries
+		if len(entries) != 2 {
+			t.Fatalf("invalid entries\n\tExpected : %v\n\tActual : %v", 2, len(entries))
+		}
+		content := entries[0].Response.Content
+		if content.Size != 102 || len(content.Text) != 10 || content.Comment != "truncated" {
+			t.Errorf("invalid capped content %+v", content)
+		}
+		if entries[1].Response.Status != 0 || entries[1].Comment == "" {
+			t.Errorf("invalid failed entry %+v", entries[1])
+		}
+	})
+
+	t.Run("testWrite", func(t *testing.T) {
+		recorder := NewHARRecorder(HAROptions{})
+		req := New(server.URL).SetHARRecorder(recorder).Get().Do()
+		req.Response.Body.Close()
+
+		var buffer bytes.Buffer
+		if _, err := recorder.WriteTo(&buffer); err != nil {
+			t.Fatal(err)
+		}
+		var har map[string]map[string]interface{}
+		if err := json.Unmarshal(buffer.Bytes(), &har); err != nil || har["log"]["version"] != "1.2" {
+			t.Errorf("invalid HAR document %v", err)
+		}
+
+		path := filepath.Join(t.TempDir(), "requests.har")
+		if err := recorder.WriteFile(path); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(path); !bytes.Equal(data, buffer.Bytes()) {
+			t.Error("file and writer output must match")
+		}
+	})
+}
@@ -13,7 +13,6 @@ import (
 	"net/url"
 	"os"
 	"reflect"
-	"strings"
 	"time"
 
 	"github.com/yudhiana/bunker"
@@ -46,9 +45,10 @@ const (
 )
 
 type Requester struct {
-	path    string
-	BaseUrl string
-	Method  string
+	paths      []pathPart
+	pathParams map[string]string
+	BaseUrl    string
+	Method     string
 
 	token     string
 	Header    map[string][]string
@@ -57,9 +57,11 @@ type Requester struct {
 	FormData  url.Values
 	QueryData url.Values
 
-	Client   *http.Client
-	Response *http.Response
-	Request  *http.Request
+	Client     *http.Client
+	httpClient *http.Client
+	cookieJar  http.CookieJar
+	Response   *http.Response
+	Request    *http.Request
 
 	TimeOut time.Duration
 
@@ -73,16 +75,56 @@ type Requester struct {
 	timeRequest time.Duration
 	timeIn      time.Time
 
-	body io.Reader
+	body               interface{}
+	payload            []byte
+	payloadContentType string
+	codecs             *Codecs
+
+	idempotency    *Idempotency
+	idempotencyKey string
+
+	attempt           int
+	attemptErrorsFrom int
+	attemptErrorsTo   int
+
+	tracer      Tracer
+	propagators []Propagator
+	metrics     Metrics
+
+	webSocketOptions WebSocketOptions
+
+	redirectPolicy *RedirectPolicy
+	redirects      []Redirect
+
+	limits *Limits
+
+	payloadSchema  *Schema
+	responseSchema *Schema
+	schemaLogOnly  bool
+
+	har *HARRecorder
+
+	debugOptions *DebugOptions
+
+	pool           *EndpointPool
+	endpoint       string
+	triedEndpoints map[string]bool
+
+	digestAuth *DigestTransport
+
+	coalescer *Coalescer
+
+	authProvider AuthProvider
 }
 
 func New(host string) *Requester {
 	return &Requester{
-		BaseUrl:   host,
-		Header:    make(map[string][]string),
-		FormData:  make(url.Values),
-		QueryData: make(url.Values),
-		basicAuth: make(map[string]string),
+		BaseUrl:    host,
+		Header:     make(map[string][]string),
+		FormData:   make(url.Values),
+		QueryData:  make(url.Values),
+		basicAuth:  make(map[string]string),
+		pathParams: make(map[string]string),
 	}
 }
 
@@ -133,7 +175,7 @@ func (base *Requester) SetHeaders(headers interface{}) *Requester {
 }
 
 func (base *Requester) setMapStringHeaders(headers map[string][]string) *Requester {
-	base.Header = headers
+	base.Header = http.Header(headers).Clone()
 	return base
 }
 
@@ -152,29 +194,53 @@ func (base *Requester) setMapAnyHeaders(headers map[string]interface{}) *Request
 func (base *Requester) SetContentType(contentType string) *Requester {
 	switch bunker.IsEmptyString(contentType) {
 	case true:
-		base.Header["Content-Type"] = append(base.Header["Content-Type"], contentType)
+		base.Header["Content-Type"] = []string{Json}
 	default:
-		base.Header["Content-Type"] = append(base.Header["Content-Type"], Json)
+		base.Header["Content-Type"] = []string{contentType}
 	}
 	return base
 }
 
+// SetClient makes Do send through client instead of a new client per request.
+func (base *Requester) SetClient(client *http.Client) *Requester {
+	base.httpClient = client
+	return base
+}
+
 func (base *Requester) initClient() *Requester {
-	jar, errCookie := cookiejar.New(&cookiejar.Options{
-		PublicSuffixList: publicsuffix.List,
-	})
-	if errCookie != nil {
-		base.Errors = append(base.Errors, errCookie)
+	if base.httpClient != nil {
+		// withRedirectPolicy returns a copy, the jar of the caller's client is
+		// left alone
+		client := base.withRedirectPolicy(base.httpClient)
+		if base.cookieJar != nil {
+			client.Jar = base.cookieJar
+		}
+		base.Client = base.withDigestAuth(client)
 		return base
 	}
+	jar := base.cookieJar
+	if jar == nil {
+		newJar, errCookie := cookiejar.New(&cookiejar.Options{
+			PublicSuffixList: publicsuffix.List,
+		})
+		if errCookie != nil {
+			base.Errors = append(base.Errors, errCookie)
+			return base
+		}
+		jar = newJar
+	}
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: base.insecureSkipVerify},
+	}
+	if base.limits != nil {
+		transport.MaxResponseHeaderBytes = base.limits.MaxHeaderSize
+	}
 	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: base.insecureSkipVerify},
-		},
-		Jar:     jar,
-		Timeout: base.TimeOut,
+		Transport: transport,
+		Jar:       jar,
+		Timeout:   base.TimeOut,
 	}
-	base.Client = client
+	base.Client = base.withDigestAuth(base.withRedirectPolicy(client))
 	return base
 }
 
@@ -188,8 +254,8 @@ func (base *Requester) initRequestClient() bool {
 		return false
 	}
 
-	if bunker.IsEmptyString(base.Request.Header.Get("Content-Type")) {
-		base.Request.Header.Add("Content-Type", Json)
+	if base.payload != nil && bunker.IsEmptyString(headerValue(base.Request.Header, "Content-Type")) {
+		base.Request.Header.Add("Content-Type", base.payloadContentType)
 	}
 
 	if bunker.IsEmptyString(base.Method) {
@@ -205,9 +271,16 @@ func (base *Requester) initRequestClient() bool {
 }
 
 func (base *Requester) Do() *Requester {
+	base.resetAttemptErrors()
+	base.attempt++
+	base.Response = nil
+	base.redirects = nil
+	base.endpoint = ""
+	base.triedEndpoints = make(map[string]bool)
 	defer func() {
+		base.attemptErrorsTo = len(base.Errors)
 		if base.HaveError() {
-			bunker.PrintErr(fmt.Sprint(base.Errors))
+			base.printErrors()
 		}
 	}()
 
@@ -216,34 +289,106 @@ func (base *Requester) Do() *Requester {
 		return base
 	}
 
+	for base.send() {
+		if !base.initRequestClient() {
+			break
+		}
+	}
+	base.timeRequest = time.Since(startTime)
+	base.timeIn = time.Now()
+	base.printDebug()
+	return base
+}
+
+// send does one exchange and reports whether it has to be sent again to
+// another endpoint of the pool.
+func (base *Requester) send() bool {
 	switch base.Method {
 	case GET, HEAD, DELETE, OPTIONS, POST, PUT, PATCH:
-		response, errRequestClient := base.Client.Do(base.Request)
+		span := base.startSpan()
+		info := base.metricsStart()
+		exchange := base.harStart()
+		sentAt := time.Now()
+		base.endpointStart()
+		response, errRequestClient := base.clientDo()
+		base.endpointFinish(response, errRequestClient)
+		base.endSpan(span, response, errRequestClient)
+		base.metricsEnd(info, response, errRequestClient, time.Since(sentAt))
 		if errRequestClient != nil {
+			if base.limits != nil {
+				errRequestClient = base.limits.mapError(errRequestClient)
+			}
+			exchange.fail(base.Request, errRequestClient)
+			if base.failover(errRequestClient) {
+				return true
+			}
 			base.Errors = append(base.Errors, errRequestClient)
-			return base
+			return false
 		}
+		if base.limits != nil {
+			if errLimit := base.limits.apply(response); errLimit != nil {
+				exchange.fail(base.Request, errLimit)
+				base.Errors = append(base.Errors, errLimit)
+				return false
+			}
+		}
+		exchange.finish(base.Request, response)
 		base.Response = response
+		base.validateResponse()
 	default:
 		base.Errors = append(base.Errors, fmt.Errorf("unsupported method of %s", base.Method))
 	}
-	base.timeRequest = time.Since(startTime)
-	base.timeIn = time.Now()
-	base.printDebug()
-	return base
+	return false
+}
+
+// resetAttemptErrors drops the errors of the previous Do call so the same
+// requester can be retried, errors collected while building it are kept.
+func (base *Requester) resetAttemptErrors() {
+	if base.attemptErrorsFrom < base.attemptErrorsTo && base.attemptErrorsTo <= len(base.Errors) {
+		base.Errors = append(base.Errors[:base.attemptErrorsFrom], base.Errors[base.attemptErrorsTo:]...)
+	}
+	base.attemptErrorsFrom = len(base.Errors)
+	base.attemptErrorsTo = len(base.Errors)
 }
 
 func (base *Requester) initRequest() *Requester {
-	request, errRequest := http.NewRequest(base.Method, base.BaseUrl, base.body)
+	if errPayload := base.encodePayload(); errPayload != nil {
+		base.Errors = append(base.Errors, errPayload)
+		return base
+	}
+	if !base.validatePayload() {
+		return base
+	}
+	var body io.Reader
+	if base.payload != nil {
+		body = bytes.NewReader(base.payload)
+	}
+	request, errRequest := base.newRequest(base.Method, body)
 	if errRequest != nil {
 		base.Errors = append(base.Errors, errRequest)
 		return base
 	}
+	base.Request = request
+	base.setIdempotencyHeader()
+	return base
+}
+
+// newRequest builds the url, headers and credentials of the requester, it
+// leaves base.Request alone.
+func (base *Requester) newRequest(method string, body io.Reader) (*http.Request, error) {
+	baseURL, errEndpoint := base.requestBaseURL()
+	if errEndpoint != nil {
+		return nil, errEndpoint
+	}
+	request, errRequest := http.NewRequest(method, baseURL, body)
+	if errRequest != nil {
+		return nil, errRequest
+	}
 	if base.Context != nil {
 		request = request.WithContext(base.Context)
 	}
 	if base.Header != nil {
-		request.Header = base.Header
+		request.Header = http.Header(base.Header).Clone()
 	}
 	if base.basicAuth != nil {
 		for user, pass := range base.basicAuth {
@@ -253,6 +398,9 @@ func (base *Requester) initRequest() *Requester {
 	if !bunker.IsEmptyString(base.token) {
 		request.Header.Add(Auth, Bearer+base.token)
 	}
+	if errToken := base.setProviderToken(request); errToken != nil {
+		return nil, errToken
+	}
 
 	reqUrl := request.URL.Query()
 	for param, values := range base.QueryData {
@@ -261,15 +409,10 @@ func (base *Requester) initRequest() *Requester {
 		}
 	}
 	request.URL.RawQuery = reqUrl.Encode()
-	if !bunker.IsEmptyString(base.path) {
-		if !bunker.IsEmptyString(request.URL.Path) {
-			request.URL.Path += base.path
-		} else {
-			request.URL.Path = base.path
-		}
+	if errPath := base.setRequestPath(request.URL); errPath != nil {
+		return nil, errPath
 	}
-	base.Request = request
-	return base
+	return request, nil
 }
 
 func (base *Requester) Get() *Requester {
@@ -319,10 +462,13 @@ func (base *Requester) SkipVerify(verify bool) *Requester {
 
 func (base *Requester) printDebug() {
 	if base.Debug || os.Getenv("debug") == "true" {
-		debugMessage := base.debug()
-		if !base.HaveError() {
-			bunker.LogInfo(debugMessage)
+		options := base.debugSettings()
+		if options.Format == DebugJSON {
+			record, _ := json.Marshal(base.debugRecord())
+			options.Logger.Debug(string(record))
+			return
 		}
+		options.Logger.Debug(base.debug())
 	}
 }
 
@@ -338,24 +484,15 @@ func (base *Requester) readAll(input io.ReadCloser) []byte {
 	return nil
 }
 
-func (base *Requester) readBodyRequest() []byte {
-	if base.Request != nil && base.Request.Body != nil {
-		result, err := io.ReadAll(base.Request.Body)
-		if err != nil {
-			base.Errors = append(base.Errors, err)
-			return nil
-		}
-		base.Request.Body = io.NopCloser(bytes.NewBuffer(result))
-		return result
-	}
-	return nil
+func nopCloser(data []byte) io.ReadCloser {
+	return io.NopCloser(bytes.NewReader(data))
 }
 
 func (base *Requester) SetPayload(body interface{}) *Requester {
 	switch reflect.ValueOf(body).Kind() {
 	case reflect.Map:
 		base.setBodyMap(body)
-	case reflect.Struct:
+	case reflect.Struct, reflect.Pointer, reflect.Slice:
 		base.setBodyStruct(body)
 	case reflect.String:
 		base.setBodyString(body)
@@ -365,8 +502,11 @@ func (base *Requester) SetPayload(body interface{}) *Requester {
 	return base
 }
 
+// AddPath appends a literal path, it is joined to the previous one with a single slash.
 func (base *Requester) AddPath(path string) *Requester {
-	base.path = path
+	if !bunker.IsEmptyString(path) {
+		base.paths = append(base.paths, pathPart{value: path})
+	}
 	return base
 }
 
@@ -380,9 +520,15 @@ func (base *Requester) Query(query interface{}) *Requester {
 		switch input := query.(type) {
 		case map[string]string:
 			base.queryMap(input)
+		case url.Values:
+			base.queryValues(input)
+		case map[string][]string:
+			base.queryValues(input)
 		default:
 			base.Errors = append(base.Errors, fmt.Errorf("unsupported type of %T", reflect.TypeOf(query)))
 		}
+	case reflect.Struct, reflect.Pointer:
+		base.queryStruct(query)
 	default:
 		base.Errors = append(base.Errors, fmt.Errorf("unsupported type of %T", reflect.TypeOf(query)))
 	}
@@ -394,8 +540,15 @@ func (base *Requester) queryString(input string) *Requester {
 		base.Errors = append(base.Errors, errParse)
 		return base
 	} else {
-		for param := range values {
-			base.QueryData.Add(param, values.Get(param))
+		base.queryValues(values)
+	}
+	return base
+}
+
+func (base *Requester) queryValues(input map[string][]string) *Requester {
+	for k, values := range input {
+		for _, v := range values {
+			base.QueryData.Add(k, v)
 		}
 	}
 	return base
@@ -410,7 +563,7 @@ func (base *Requester) queryMap(input map[string]string) *Requester {
 
 func (base *Requester) setBodyMap(input interface{}) {
 	switch data := input.(type) {
-	case map[string]interface{}, map[string]string:
+	case map[string]interface{}, map[string]string, map[string][]string, url.Values:
 		base.setBodyMapString(data)
 	default:
 		base.Errors = append(base.Errors, fmt.Errorf("unsupported type of %T", reflect.TypeOf(data)))
@@ -418,31 +571,21 @@ func (base *Requester) setBodyMap(input interface{}) {
 }
 
 func (base *Requester) setBodyMapString(input interface{}) *Requester {
-	dataMarshal, errMarshal := json.Marshal(input)
-	if errMarshal != nil {
-		base.Errors = append(base.Errors, errMarshal)
-		return base
-	}
-
-	base.body = strings.NewReader(string(dataMarshal))
+	base.body = input
 	return base
 }
 
+// setBodyStruct keeps the value, it is encoded by the codec of the request
+// content type when the request is built.
 func (base *Requester) setBodyStruct(input interface{}) *Requester {
-	dataMarshal, errMarshal := json.Marshal(input)
-	if errMarshal != nil {
-		base.Errors = append(base.Errors, errMarshal)
-		return base
-	}
-
-	base.body = strings.NewReader(string(dataMarshal))
+	base.body = input
 	return base
 }
 
 func (base *Requester) setBodyString(input interface{}) *Requester {
 	switch data := input.(type) {
 	case string:
-		base.body = strings.NewReader(data)
+		base.body = data
 	default:
 		base.Errors = append(base.Errors, fmt.Errorf("unsupported type of %T", reflect.TypeOf(data)))
 	}
@@ -451,12 +594,16 @@ func (base *Requester) setBodyString(input interface{}) *Requester {
 
 func (base *Requester) debug() string {
 	if base.Request != nil {
+		record := base.debugRecord()
 		return fmt.Sprintf(
 			`
 	REQUEST
 	==========================================================
 	%s / %s / %s
 	URL             : %s
+	ROUTE           : %s
+	ENDPOINT        : %s
+	REDIRECTS       : %s
 	HEADERS         : %v
 	BODY REQUEST    : 
 	%v
@@ -464,24 +611,28 @@ func (base *Requester) debug() string {
 	RESPONSE
 	==========================================================
 	STATUS          : %s
-	RECEIVED AT     : %v
-	RESPONSE TIME   : %v
+	ERROR           : %s
+%s	RESPONSE TIME   : %v
 	
 	BODY RESPONSE   :
 	%v
 
 	==========================================================
 	`,
-			time.Now().Format("2006/01/02 15:04:05"),
-			base.Method,
-			base.Request.Proto,
-			base.Request.URL,
-			base.headerToString(),
-			string(base.readBodyRequest()),
-			base.Response.Status,
-			base.timeIn.Format(time.RFC1123),
-			base.timeRequest.Seconds(),
-			string(base.readAll(base.Response.Body)),
+			record.Time.Format("2006/01/02 15:04:05"),
+			record.Method,
+			record.Proto,
+			record.URL,
+			record.Route,
+			orDash(record.Endpoint),
+			debugRedirects(record.Redirects),
+			headerToString(record.RequestHeaders),
+			record.RequestBody,
+			record.Status,
+			orDash(record.Error),
+			debugReceivedAt(record.ReceivedAt),
+			record.DurationSeconds,
+			record.ResponseBody,
 		)
 	} else {
 		base.Errors = append(base.Errors, errors.New("can't debug before request"))
@@ -489,10 +640,10 @@ func (base *Requester) debug() string {
 	}
 }
 
-func (base *Requester) headerToString() (result string) {
-	if base.Request.Header != nil {
-		header, _ := json.Marshal(base.Request.Header)
-		return string(header)
+func headerToString(header map[string][]string) (result string) {
+	if header != nil {
+		data, _ := json.Marshal(header)
+		return string(data)
 	}
 	return
 }
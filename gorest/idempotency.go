@@ -0,0 +1,177 @@
+package bunker
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const IdempotencyKeyHeader string = "Idempotency-Key"
+
+// IdempotencyStore persists the key of an operation so that a process restarted
+// in the middle of that operation sends the same key again.
+type IdempotencyStore interface {
+	Load(operation string) (key string, found bool, err error)
+	Save(operation string, key string) error
+	Delete(operation string) error
+}
+
+// Idempotency configures the idempotency key attached to unsafe requests.
+// Empty fields fall back to the Idempotency-Key header, a random UUID and the
+// POST and PATCH methods.
+type Idempotency struct {
+	Header    string
+	Generator func() (string, error)
+	Methods   []string
+
+	Store     IdempotencyStore
+	Operation string
+}
+
+func (base *Requester) SetIdempotency(idempotency Idempotency) *Requester {
+	if idempotency.Store != nil && idempotency.Operation == "" {
+		base.Errors = append(base.Errors, errors.New("idempotency store requires an operation name"))
+		return base
+	}
+	base.idempotency = &idempotency
+	return base
+}
+
+// SetIdempotencyKey pins the key instead of generating one.
+func (base *Requester) SetIdempotencyKey(key string) *Requester {
+	if base.idempotency == nil {
+		base.idempotency = &Idempotency{}
+	}
+	base.idempotencyKey = key
+	return base
+}
+
+// IdempotencyKey returns the key sent with this requester, it stays the same
+// for every Do call.
+func (base *Requester) IdempotencyKey() string {
+	return base.idempotencyKey
+}
+
+// ReleaseIdempotencyKey removes the key from the store once the operation is
+// settled, the next Do call will then use a new key.
+func (base *Requester) ReleaseIdempotencyKey() *Requester {
+	if base.idempotency == nil {
+		return base
+	}
+	if base.idempotency.Store != nil {
+		if err := base.idempotency.Store.Delete(base.idempotency.Operation); err != nil {
+			base.Errors = append(base.Errors, err)
+			return base
+		}
+	}
+	base.idempotencyKey = ""
+	return base
+}
+
+func (base *Requester) setIdempotencyHeader() {
+	if base.idempotency == nil || !base.idempotency.appliesTo(base.Method) {
+		return
+	}
+	if base.idempotencyKey == "" {
+		key, err := base.idempotency.resolveKey()
+		if err != nil {
+			base.Errors = append(base.Errors, err)
+			return
+		}
+		base.idempotencyKey = key
+	}
+	base.Request.Header.Set(base.idempotency.header(), base.idempotencyKey)
+}
+
+func (idempotency *Idempotency) header() string {
+	if idempotency.Header == "" {
+		return IdempotencyKeyHeader
+	}
+	return idempotency.Header
+}
+
+func (idempotency *Idempotency) appliesTo(method string) bool {
+	if len(idempotency.Methods) == 0 {
+		return method == POST || method == PATCH
+	}
+	for _, allowed := range idempotency.Methods {
+		if allowed == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (idempotency *Idempotency) resolveKey() (string, error) {
+	if idempotency.Store != nil {
+		key, found, err := idempotency.Store.Load(idempotency.Operation)
+		if err != nil {
+			return "", err
+		}
+		if found {
+			return key, nil
+		}
+	}
+
+	generate := idempotency.Generator
+	if generate == nil {
+		generate = NewIdempotencyKey
+	}
+	key, err := generate()
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		return "", errors.New("idempotency key generator returned an empty key")
+	}
+
+	if idempotency.Store != nil {
+		if err := idempotency.Store.Save(idempotency.Operation, key); err != nil {
+			return "", err
+		}
+	}
+	return key, nil
+}
+
+// NewIdempotencyKey returns a random version 4 UUID.
+func NewIdempotencyKey() (string, error) {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		return "", err
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:]), nil
+}
+
+type memoryIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[string]string
+}
+
+// NewMemoryIdempotencyStore keeps keys for the lifetime of the process.
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{keys: make(map[string]string)}
+}
+
+func (store *memoryIdempotencyStore) Load(operation string) (string, bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	key, found := store.keys[operation]
+	return key, found, nil
+}
+
+func (store *memoryIdempotencyStore) Save(operation string, key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.keys[operation] = key
+	return nil
+}
+
+func (store *memoryIdempotencyStore) Delete(operation string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.keys, operation)
+	return nil
+}
@@ -0,0 +1,81 @@
+package bunker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIdempotency(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get(IdempotencyKeyHeader))
+	}))
+	defer server.Close()
+
+	t.Run("testStableAcrossRetries", func(t *testing.T) {
+		received = nil
+		req := New(server.URL).Post().SetPayload(map[string]string{"amount": "10"}).SetIdempotency(Idempotency{})
+		req.Do()
+		req.Do()
+		if req.HaveError() {
+			t.Fatal(req.Errors)
+		}
+		if len(received) != 2 || received[0] == "" || received[0] != received[1] {
+			t.Errorf("invalid idempotency key\n\tExpected : same key twice\n\tActual : %v", received)
+		}
+		if req.IdempotencyKey() != received[0] {
+			t.Errorf("invalid idempotency key\n\tExpected : %v\n\tActual : %v", received[0], req.IdempotencyKey())
+		}
+	})
+
+	t.Run("testSafeMethodWithoutKey", func(t *testing.T) {
+		received = nil
+		New(server.URL).Get().SetIdempotency(Idempotency{}).Do()
+		if len(received) != 1 || received[0] != "" {
+			t.Errorf("invalid idempotency key\n\tExpected : no key\n\tActual : %v", received)
+		}
+	})
+
+	t.Run("testStoreAndCustomHeader", func(t *testing.T) {
+		var custom []string
+		customServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			custom = append(custom, r.Header.Get("X-Request-Key"))
+		}))
+		defer customServer.Close()
+
+		store := NewMemoryIdempotencyStore()
+		generated := 0
+		config := Idempotency{
+			Header: "X-Request-Key",
+			Generator: func() (string, error) {
+				generated++
+				return "key-1", nil
+			},
+			Store:     store,
+			Operation: "charge-42",
+		}
+
+		// a second requester simulates a restarted process
+		New(customServer.URL).Post().SetIdempotency(config).Do()
+		restarted := New(customServer.URL).Post().SetIdempotency(config).Do()
+		if generated != 1 || len(custom) != 2 || custom[1] != "key-1" {
+			t.Errorf("invalid stored key\n\tExpected : key-1 generated once\n\tActual : %v generated %d", custom, generated)
+		}
+
+		restarted.ReleaseIdempotencyKey()
+		if _, found, _ := store.Load("charge-42"); found {
+			t.Error("released key must be removed from the store")
+		}
+	})
+}
+
+func TestNewIdempotencyKey(t *testing.T) {
+	key, err := NewIdempotencyKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 36 || key[14] != '4' {
+		t.Errorf("invalid uuid %s", key)
+	}
+}
@@ -0,0 +1,245 @@
+package bunker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	gorest "github.com/yudhiana/bunker/gorest"
+)
+
+const Version string = "2.0"
+
+// Error codes defined by the JSON-RPC 2.0 specification.
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+)
+
+// Error is a JSON-RPC error object.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc: %s (%d)", e.Message, e.Code)
+}
+
+// DecodeData unmarshals the optional data member of the error.
+func (e *Error) DecodeData(v interface{}) error {
+	if len(e.Data) == 0 {
+		return errors.New("jsonrpc: error has no data")
+	}
+	return json.Unmarshal(e.Data, v)
+}
+
+type request struct {
+	Version string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+	ID      *int64      `json:"id,omitempty"`
+}
+
+type response struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *Error          `json:"error"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Client sends JSON-RPC 2.0 calls over HTTP POST, ids are assigned from a
+// counter shared by every call of the client.
+type Client struct {
+	endpoint string
+	prepare  []func(req *gorest.Requester)
+	nextID   int64
+}
+
+func New(endpoint string) *Client {
+	return &Client{endpoint: endpoint}
+}
+
+// Use configures every requester the client creates, e.g. to set a token.
+func (c *Client) Use(prepare func(req *gorest.Requester)) *Client {
+	c.prepare = append(c.prepare, prepare)
+	return c
+}
+
+func (c *Client) newID() *int64 {
+	id := atomic.AddInt64(&c.nextID, 1)
+	return &id
+}
+
+// Call invokes method and decodes the result into result, which may be nil.
+// A JSON-RPC error object is returned as *Error.
+func (c *Client) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	id := c.newID()
+	body, err := c.post(ctx, request{Version: Version, Method: method, Params: params, ID: id})
+	if err != nil {
+		return err
+	}
+	var res response
+	if err := json.Unmarshal(body, &res); err != nil {
+		return fmt.Errorf("jsonrpc: invalid response: %w", err)
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if !matchID(res.ID, *id) {
+		return fmt.Errorf("jsonrpc: response id %s does not match request id %d", res.ID, *id)
+	}
+	return decodeResult(res.Result, result)
+}
+
+// Notify sends a notification, the server does not answer it.
+func (c *Client) Notify(ctx context.Context, method string, params interface{}) error {
+	_, err := c.post(ctx, request{Version: Version, Method: method, Params: params})
+	return err
+}
+
+func (c *Client) post(ctx context.Context, payload interface{}) ([]byte, error) {
+	req := gorest.New(c.endpoint).Post()
+	for _, prepare := range c.prepare {
+		prepare(req)
+	}
+	req.SetContext(ctx).SetContentType(gorest.Json).SetAccept(gorest.Json).SetPayload(payload).Do()
+	if req.HaveError() {
+		return nil, fmt.Errorf("jsonrpc: %w", req.Err())
+	}
+	defer req.Response.Body.Close()
+	body, err := io.ReadAll(req.Response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if req.Response.StatusCode >= http.StatusMultipleChoices && len(bytes.TrimSpace(body)) == 0 {
+		return nil, fmt.Errorf("jsonrpc: unexpected status %s", req.Response.Status)
+	}
+	return body, nil
+}
+
+// Batch collects calls and notifications that are sent in one request.
+type Batch struct {
+	client   *Client
+	requests []request
+	calls    map[int64]*Call
+}
+
+// Call is the pending result of a call added to a batch.
+type Call struct {
+	Method string
+	result interface{}
+	err    error
+	done   bool
+}
+
+// Err is the error of this call once the batch was sent.
+func (call *Call) Err() error {
+	if !call.done {
+		return errors.New("jsonrpc: batch has not been sent")
+	}
+	return call.err
+}
+
+func (c *Client) Batch() *Batch {
+	return &Batch{client: c, calls: make(map[int64]*Call)}
+}
+
+func (b *Batch) Call(method string, params interface{}, result interface{}) *Call {
+	id := b.client.newID()
+	call := &Call{Method: method, result: result}
+	b.requests = append(b.requests, request{Version: Version, Method: method, Params: params, ID: id})
+	b.calls[*id] = call
+	return call
+}
+
+func (b *Batch) Notify(method string, params interface{}) *Batch {
+	b.requests = append(b.requests, request{Version: Version, Method: method, Params: params})
+	return b
+}
+
+// Do sends the batch and matches the responses back to their calls by id.
+// The returned error covers the batch as a whole, call errors are read from
+// each Call.
+func (b *Batch) Do(ctx context.Context) error {
+	if len(b.requests) == 0 {
+		return errors.New("jsonrpc: empty batch")
+	}
+	body, err := b.client.post(ctx, b.requests)
+	if err != nil {
+		return b.fail(err)
+	}
+	if len(b.calls) == 0 {
+		return nil
+	}
+
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '{' {
+		// the server rejected the batch as a whole
+		var res response
+		if err := json.Unmarshal(body, &res); err != nil {
+			return b.fail(fmt.Errorf("jsonrpc: invalid response: %w", err))
+		}
+		if res.Error != nil {
+			return b.fail(res.Error)
+		}
+		return b.fail(errors.New("jsonrpc: batch answered with a single response"))
+	}
+
+	var responses []response
+	if err := json.Unmarshal(body, &responses); err != nil {
+		return b.fail(fmt.Errorf("jsonrpc: invalid response: %w", err))
+	}
+	for _, res := range responses {
+		var id int64
+		if err := json.Unmarshal(res.ID, &id); err != nil {
+			continue
+		}
+		call, found := b.calls[id]
+		if !found || call.done {
+			continue
+		}
+		call.done = true
+		if res.Error != nil {
+			call.err = res.Error
+			continue
+		}
+		call.err = decodeResult(res.Result, call.result)
+	}
+	for id, call := range b.calls {
+		if !call.done {
+			call.done = true
+			call.err = fmt.Errorf("jsonrpc: no response for id %d", id)
+		}
+	}
+	return nil
+}
+
+func (b *Batch) fail(err error) error {
+	for _, call := range b.calls {
+		call.done = true
+		call.err = err
+	}
+	return err
+}
+
+func matchID(raw json.RawMessage, id int64) bool {
+	var actual int64
+	return json.Unmarshal(raw, &actual) == nil && actual == id
+}
+
+func decodeResult(raw json.RawMessage, result interface{}) error {
+	if result == nil || len(raw) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw, result)
+}
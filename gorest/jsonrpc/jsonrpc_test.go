@@ -0,0 +1,133 @@
+package bunker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type rpcMessage struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  []int           `json:"params"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+func answer(message rpcMessage) map[string]interface{} {
+	reply := map[string]interface{}{"jsonrpc": Version, "id": message.ID}
+	switch message.Method {
+	case "sum":
+		total := 0
+		for _, param := range message.Params {
+			total += param
+		}
+		reply["result"] = total
+	default:
+		reply["error"] = map[string]interface{}{"code": MethodNotFound, "message": "Method not found", "data": map[string]string{"method": message.Method}}
+	}
+	return reply
+}
+
+func TestJSONRPC(t *testing.T) {
+	var notified []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if body[0] == '[' {
+			var batch []rpcMessage
+			_ = json.Unmarshal(body, &batch)
+			var replies []map[string]interface{}
+			// answered in reverse order to exercise id matching
+			for i := len(batch) - 1; i >= 0; i-- {
+				if batch[i].ID == nil {
+					notified = append(notified, batch[i].Method)
+					continue
+				}
+				replies = append(replies, answer(batch[i]))
+			}
+			if len(replies) == 0 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(replies)
+			return
+		}
+
+		var message rpcMessage
+		_ = json.Unmarshal(body, &message)
+		if message.ID == nil {
+			notified = append(notified, message.Method)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(answer(message))
+	}))
+	defer server.Close()
+
+	client := New(server.URL)
+	ctx := context.Background()
+
+	t.Run("testCall", func(t *testing.T) {
+		var total int
+		if err := client.Call(ctx, "sum", []int{1, 2, 3}, &total); err != nil {
+			t.Fatal(err)
+		}
+		if total != 6 {
+			t.Errorf("invalid result\n\tExpected : 6\n\tActual : %v", total)
+		}
+	})
+
+	t.Run("testError", func(t *testing.T) {
+		err := client.Call(ctx, "missing", nil, nil)
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) || rpcErr.Code != MethodNotFound {
+			t.Fatalf("invalid error %v", err)
+		}
+		var data map[string]string
+		if err := rpcErr.DecodeData(&data); err != nil || data["method"] != "missing" {
+			t.Errorf("invalid error data %v %v", data, err)
+		}
+	})
+
+	t.Run("testNotify", func(t *testing.T) {
+		notified = nil
+		if err := client.Notify(ctx, "ping", nil); err != nil {
+			t.Fatal(err)
+		}
+		if len(notified) != 1 || notified[0] != "ping" {
+			t.Errorf("invalid notification %v", notified)
+		}
+	})
+
+	t.Run("testBatch", func(t *testing.T) {
+		notified = nil
+		var first, second int
+		batch := client.Batch()
+		firstCall := batch.Call("sum", []int{1, 1}, &first)
+		secondCall := batch.Call("sum", []int{2, 2}, &second)
+		missingCall := batch.Call("missing", nil, nil)
+		batch.Notify("log", nil)
+		if err := batch.Do(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if firstCall.Err() != nil || secondCall.Err() != nil || first != 2 || second != 4 {
+			t.Errorf("invalid batch results %d %d", first, second)
+		}
+		var rpcErr *Error
+		if !errors.As(missingCall.Err(), &rpcErr) {
+			t.Errorf("invalid batch error %v", missingCall.Err())
+		}
+		if len(notified) != 1 {
+			t.Errorf("invalid batch notification %v", notified)
+		}
+	})
+
+	t.Run("testNotificationOnlyBatch", func(t *testing.T) {
+		if err := client.Batch().Notify("a", nil).Notify("b", nil).Do(ctx); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
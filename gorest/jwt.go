@@ -0,0 +1,335 @@
+package bunker
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthProvider gives the bearer token of every attempt, it is asked again on
+// retries so it can refresh the token.
+type AuthProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+func (base *Requester) SetAuthProvider(provider AuthProvider) *Requester {
+	base.authProvider = provider
+	return base
+}
+
+func (base *Requester) setProviderToken(request *http.Request) error {
+	if base.authProvider == nil {
+		return nil
+	}
+	token, err := base.authProvider.Token(request.Context())
+	if err != nil {
+		return err
+	}
+	request.Header.Set(Auth, Bearer+token)
+	return nil
+}
+
+type JWTAlgorithm string
+
+const (
+	RS256 JWTAlgorithm = "RS256"
+	ES256 JWTAlgorithm = "ES256"
+	HS256 JWTAlgorithm = "HS256"
+)
+
+const (
+	DefaultJWTLifetime = 5 * time.Minute
+	// DefaultTokenRefresh is how long before expiry a cached token is
+	// replaced.
+	DefaultTokenRefresh = 30 * time.Second
+)
+
+const JWTBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+type JWTConfig struct {
+	Algorithm JWTAlgorithm
+	// Key is the PEM private key for RS256 and ES256, in PKCS #1, SEC 1 or
+	// PKCS #8 form, and the secret for HS256.
+	Key []byte
+	// KeyFile is read when Key is empty.
+	KeyFile string
+	KeyID   string
+
+	Issuer string
+	// Subject defaults to Issuer.
+	Subject  string
+	Audience string
+	// Lifetime defaults to DefaultJWTLifetime.
+	Lifetime time.Duration
+	// RefreshBefore defaults to DefaultTokenRefresh, capped to half of
+	// Lifetime.
+	RefreshBefore time.Duration
+	// Claims are added to the registered claims, which take precedence.
+	Claims map[string]interface{}
+}
+
+// JWTSigner mints short-lived JWTs, Token caches one until it is about to
+// expire.
+type JWTSigner struct {
+	config JWTConfig
+	key    interface{}
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+	now    func() time.Time
+}
+
+func NewJWTSigner(config JWTConfig) (*JWTSigner, error) {
+	if len(config.Key) == 0 && config.KeyFile != "" {
+		key, err := os.ReadFile(config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Key = key
+	}
+	if len(config.Key) == 0 {
+		return nil, errors.New("jwt signing key is empty")
+	}
+	if config.Subject == "" {
+		config.Subject = config.Issuer
+	}
+	if config.Lifetime <= 0 {
+		config.Lifetime = DefaultJWTLifetime
+	}
+	if config.RefreshBefore <= 0 {
+		config.RefreshBefore = DefaultTokenRefresh
+	}
+	if config.RefreshBefore > config.Lifetime/2 {
+		config.RefreshBefore = config.Lifetime / 2
+	}
+
+	signer := &JWTSigner{config: config, now: time.Now}
+	switch config.Algorithm {
+	case HS256:
+		signer.key = config.Key
+	case RS256, ES256:
+		key, err := parsePrivateKey(config.Key)
+		if err != nil {
+			return nil, err
+		}
+		_, isRSA := key.(*rsa.PrivateKey)
+		ecKey, isEC := key.(*ecdsa.PrivateKey)
+		if config.Algorithm == RS256 && !isRSA || config.Algorithm == ES256 && (!isEC || ecKey.Curve != elliptic.P256()) {
+			return nil, fmt.Errorf("%s does not support a %T key", config.Algorithm, key)
+		}
+		signer.key = key
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", config.Algorithm)
+	}
+	return signer, nil
+}
+
+func parsePrivateKey(data []byte) (interface{}, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("jwt signing key is not PEM encoded")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// Token returns the cached JWT, a new one is signed when it expires within
+// RefreshBefore.
+func (signer *JWTSigner) Token(context.Context) (string, error) {
+	signer.mu.Lock()
+	defer signer.mu.Unlock()
+	if signer.token != "" && signer.now().Add(signer.config.RefreshBefore).Before(signer.expiry) {
+		return signer.token, nil
+	}
+	token, err := signer.Sign()
+	if err != nil {
+		return "", err
+	}
+	signer.token, signer.expiry = token, signer.now().Add(signer.config.Lifetime)
+	return token, nil
+}
+
+// Sign mints a new JWT with its own ID.
+func (signer *JWTSigner) Sign() (string, error) {
+	now := signer.now()
+	claims := make(map[string]interface{}, len(signer.config.Claims)+6)
+	for name, value := range signer.config.Claims {
+		claims[name] = value
+	}
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(signer.config.Lifetime).Unix()
+	claims["jti"] = hex.EncodeToString(jti)
+	for name, value := range map[string]string{"iss": signer.config.Issuer, "sub": signer.config.Subject, "aud": signer.config.Audience} {
+		if value != "" {
+			claims[name] = value
+		}
+	}
+
+	header := map[string]string{"alg": string(signer.config.Algorithm), "typ": "JWT"}
+	if signer.config.KeyID != "" {
+		header["kid"] = signer.config.KeyID
+	}
+	encodedHeader, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	encodedClaims, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(encodedHeader) + "." + base64.RawURLEncoding.EncodeToString(encodedClaims)
+
+	signature, err := signer.signature([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (signer *JWTSigner) signature(input []byte) ([]byte, error) {
+	digest := sha256.Sum256(input)
+	switch key := signer.key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// JWS wants the fixed size R || S form instead of ASN.1
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	}
+	return nil, fmt.Errorf("unsupported jwt signing key %T", signer.key)
+}
+
+// JWTBearerGrant exchanges a JWT signed by Assertion for an access token at
+// TokenURL, following RFC 7523. The access token is cached until it is about
+// to expire, for the Lifetime of Assertion when the answer has no expires_in.
+type JWTBearerGrant struct {
+	TokenURL  string
+	Assertion *JWTSigner
+	Scopes    []string
+	// Client may be nil for a client per request.
+	Client *http.Client
+	// RefreshBefore defaults to DefaultTokenRefresh.
+	RefreshBefore time.Duration
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+	now    func() time.Time
+}
+
+func NewJWTBearerGrant(tokenURL string, assertion *JWTSigner, scopes ...string) *JWTBearerGrant {
+	return &JWTBearerGrant{TokenURL: tokenURL, Assertion: assertion, Scopes: scopes}
+}
+
+// TokenError is the error answer of a token endpoint.
+type TokenError struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *TokenError) Error() string {
+	message := fmt.Sprintf("token endpoint answered %d", e.StatusCode)
+	if e.Code != "" {
+		message += " " + e.Code
+	}
+	if e.Description != "" {
+		message += ": " + e.Description
+	}
+	return message
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (grant *JWTBearerGrant) Token(ctx context.Context) (string, error) {
+	grant.mu.Lock()
+	defer grant.mu.Unlock()
+	now := time.Now
+	if grant.now != nil {
+		now = grant.now
+	}
+	refreshBefore := grant.RefreshBefore
+	if refreshBefore <= 0 {
+		refreshBefore = DefaultTokenRefresh
+	}
+	if grant.token != "" && now().Add(refreshBefore).Before(grant.expiry) {
+		return grant.token, nil
+	}
+
+	assertion, err := grant.Assertion.Sign()
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {JWTBearerGrantType}, "assertion": {assertion}}
+	if len(grant.Scopes) > 0 {
+		form.Set("scope", strings.Join(grant.Scopes, " "))
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	req := New(grant.TokenURL).SetContext(ctx).SetClient(grant.Client).SetContentType(Form).SetAccept(Json).Post().SetPayload(form)
+	token, response, err := Do[tokenResponse](req)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		tokenErr := &TokenError{StatusCode: statusErr.StatusCode}
+		_ = json.Unmarshal(statusErr.Body, tokenErr)
+		return "", tokenErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", &TokenError{StatusCode: response.StatusCode, Description: "no access_token in the answer"}
+	}
+	lifetime := time.Duration(token.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		// expires_in is only recommended by RFC 6749
+		lifetime = grant.Assertion.config.Lifetime
+	}
+	grant.token, grant.expiry = token.AccessToken, now().Add(lifetime)
+	return grant.token, nil
+}
@@ -0,0 +1,201 @@
+package bunker
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJWTSigner(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDER, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+	ecPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: ecDER})
+
+	split := func(t *testing.T, token string) (map[string]interface{}, map[string]interface{}, []byte, []byte) {
+		parts := strings.Split(token, ".")
+		if len(parts) != 3 {
+			t.Fatalf("invalid token %v", token)
+		}
+		var header, claims map[string]interface{}
+		data, _ := base64.RawURLEncoding.DecodeString(parts[0])
+		_ = json.Unmarshal(data, &header)
+		data, _ = base64.RawURLEncoding.DecodeString(parts[1])
+		_ = json.Unmarshal(data, &claims)
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		return header, claims, signature, digest[:]
+	}
+
+	t.Run("testRS256", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "key.pem")
+		_ = os.WriteFile(path, rsaPEM, 0600)
+		signer, err := NewJWTSigner(JWTConfig{Algorithm: RS256, KeyFile: path, KeyID: "k1", Issuer: "orders", Audience: "billing", Claims: map[string]interface{}{"iss": "other", "tenant": "a"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, _ := signer.Token(context.Background())
+		header, claims, signature, digest := split(t, token)
+		if err := rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest, signature); err != nil {
+			t.Errorf("invalid signature %v", err)
+		}
+		if header["alg"] != "RS256" || header["kid"] != "k1" {
+			t.Errorf("invalid header %v", header)
+		}
+		if claims["iss"] != "orders" || claims["sub"] != "orders" || claims["aud"] != "billing" || claims["tenant"] != "a" || claims["jti"] == nil {
+			t.Errorf("invalid claims %v", claims)
+		}
+		if exp := claims["exp"].(float64) - claims["iat"].(float64); exp != DefaultJWTLifetime.Seconds() {
+			t.Errorf("invalid lifetime\n\tExpected : %v\n\tActual : %v", DefaultJWTLifetime.Seconds(), exp)
+		}
+	})
+
+	t.Run("testES256", func(t *testing.T) {
+		signer, err := NewJWTSigner(JWTConfig{Algorithm: ES256, Key: ecPEM, Issuer: "orders"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, _ := signer.Sign()
+		_, _, signature, digest := split(t, token)
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if len(signature) != 64 || !ecdsa.Verify(&ecKey.PublicKey, digest, r, s) {
+			t.Errorf("invalid signature")
+		}
+	})
+
+	t.Run("testHS256", func(t *testing.T) {
+		signer, _ := NewJWTSigner(JWTConfig{Algorithm: HS256, Key: []byte("secret"), Issuer: "orders"})
+		token, _ := signer.Sign()
+		parts := strings.Split(token, ".")
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		if parts[2] != base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("invalid signature")
+		}
+	})
+
+	t.Run("testKeyMismatch", func(t *testing.T) {
+		if _, err := NewJWTSigner(JWTConfig{Algorithm: ES256, Key: rsaPEM}); err == nil {
+			t.Errorf("ES256 must refuse an RSA key")
+		}
+		if _, err := NewJWTSigner(JWTConfig{Algorithm: "none", Key: []byte("x")}); err == nil {
+			t.Errorf("unknown algorithms must be refused")
+		}
+	})
+
+	t.Run("testCachedAndRefreshed", func(t *testing.T) {
+		now := time.Now()
+		signer, _ := NewJWTSigner(JWTConfig{Algorithm: HS256, Key: []byte("secret"), Lifetime: time.Minute, RefreshBefore: 10 * time.Second})
+		signer.now = func() time.Time { return now }
+		first, _ := signer.Token(context.Background())
+		now = now.Add(45 * time.Second)
+		if second, _ := signer.Token(context.Background()); second != first {
+			t.Errorf("token must be cached until it is about to expire")
+		}
+		now = now.Add(10 * time.Second)
+		if third, _ := signer.Token(context.Background()); third == first {
+			t.Errorf("token must be refreshed before it expires")
+		}
+	})
+
+	t.Run("testAuthProvider", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, r.Header.Get(Auth))
+		}))
+		defer server.Close()
+		signer, _ := NewJWTSigner(JWTConfig{Algorithm: HS256, Key: []byte("secret")})
+		token, _ := signer.Token(context.Background())
+
+		req := New(server.URL).SetAuthProvider(signer).Get().Do()
+		data, _ := io.ReadAll(req.Response.Body)
+		if string(data) != Bearer+token {
+			t.Errorf("invalid authorization\n\tExpected : %v\n\tActual : %v", Bearer+token, string(data))
+		}
+	})
+}
+
+func TestJWTBearerGrant(t *testing.T) {
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		_ = r.ParseForm()
+		w.Header().Set("Content-Type", Json)
+		if r.Form.Get("grant_type") != JWTBearerGrantType || strings.Count(r.Form.Get("assertion"), ".") != 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"error":"invalid_grant","error_description":"bad assertion"}`)
+			return
+		}
+		if r.Form.Get("scope") == "denied" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"error":"invalid_scope"}`)
+			return
+		}
+		if r.Form.Get("scope") == "no-expiry" {
+			_, _ = io.WriteString(w, `{"access_token":"access-no-expiry","token_type":"Bearer"}`)
+			return
+		}
+		_, _ = io.WriteString(w, `{"access_token":"access-`+r.Form.Get("scope")+`","token_type":"Bearer","expires_in":3600}`)
+	}))
+	defer server.Close()
+	signer, _ := NewJWTSigner(JWTConfig{Algorithm: HS256, Key: []byte("secret"), Issuer: "orders", Audience: server.URL})
+
+	t.Run("testExchangeAndCache", func(t *testing.T) {
+		grant := NewJWTBearerGrant(server.URL, signer, "read", "write")
+		for i := 0; i < 3; i++ {
+			token, err := grant.Token(context.Background())
+			if err != nil || token != "access-read write" {
+				t.Fatalf("invalid token %q %v", token, err)
+			}
+		}
+		if calls := atomic.LoadInt64(&calls); calls != 1 {
+			t.Errorf("invalid token endpoint calls\n\tExpected : %v\n\tActual : %v", 1, calls)
+		}
+	})
+
+	t.Run("testNoExpiresIn", func(t *testing.T) {
+		before := atomic.LoadInt64(&calls)
+		grant := NewJWTBearerGrant(server.URL, signer, "no-expiry")
+		for i := 0; i < 3; i++ {
+			if token, err := grant.Token(context.Background()); err != nil || token != "access-no-expiry" {
+				t.Fatalf("invalid token %q %v", token, err)
+			}
+		}
+		if calls := atomic.LoadInt64(&calls) - before; calls != 1 {
+			t.Errorf("invalid token endpoint calls\n\tExpected : %v\n\tActual : %v", 1, calls)
+		}
+	})
+
+	t.Run("testTokenError", func(t *testing.T) {
+		_, err := NewJWTBearerGrant(server.URL, signer, "denied").Token(context.Background())
+		var tokenErr *TokenError
+		if !errors.As(err, &tokenErr) || tokenErr.Code != "invalid_scope" || tokenErr.StatusCode != http.StatusBadRequest {
+			t.Errorf("invalid error %v", err)
+		}
+
+		req := New(server.URL).SetAuthProvider(NewJWTBearerGrant(server.URL, signer, "denied")).Get().Do()
+		if !errors.As(req.Err(), &tokenErr) {
+			t.Errorf("requester must collect the token error, got %v", req.Err())
+		}
+	})
+}
@@ -0,0 +1,261 @@
+package bunker
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	apperr "github.com/yudhiana/bunker/errors"
+)
+
+// Limits protects a client from oversized and slow responses, a zero field
+// disables its limit.
+type Limits struct {
+	// MaxBodySize caps the bytes read from a response body.
+	MaxBodySize int64
+	// MaxHeaderSize caps the size of the response headers.
+	MaxHeaderSize int64
+	// IdleTimeout cuts off a body read that receives nothing for this long.
+	IdleTimeout time.Duration
+	// MinThroughput in bytes per second is enforced on the body once
+	// ThroughputWindow, by default one second, has passed.
+	MinThroughput    int64
+	ThroughputWindow time.Duration
+}
+
+type LimitKind string
+
+const (
+	BodySizeLimit   LimitKind = "body size"
+	HeaderSizeLimit LimitKind = "header size"
+	IdleReadLimit   LimitKind = "idle read"
+	ThroughputLimit LimitKind = "throughput"
+)
+
+// LimitError reports a breached limit.
+type LimitError struct {
+	Kind LimitKind
+	// Limit is in bytes, or bytes per second for ThroughputLimit.
+	Limit   int64
+	Timeout time.Duration
+}
+
+func (e *LimitError) Error() string {
+	switch e.Kind {
+	case IdleReadLimit:
+		return fmt.Sprintf("response body idle for more than %v", e.Timeout)
+	case ThroughputLimit:
+		return fmt.Sprintf("response body slower than %d bytes per second", e.Limit)
+	}
+	return fmt.Sprintf("response %s exceeds %d bytes", e.Kind, e.Limit)
+}
+
+// ApplicationError maps size breaches to RequestEntityTooLarge and slow
+// bodies to RequestTimeout.
+func (e *LimitError) ApplicationError() *apperr.ApplicationError {
+	code := apperr.StatusRequestEntityTooLarge
+	if e.Kind == IdleReadLimit || e.Kind == ThroughputLimit {
+		code = apperr.StatusRequestTimeout
+	}
+	// New returns a shared value, it must not be modified
+	appErr := *apperr.New(code)
+	return appErr.SetError(e)
+}
+
+// SetLimits applies limits to the responses of this requester, on top of the
+// limits of a client wrapped by Limits.Client.
+func (base *Requester) SetLimits(limits Limits) *Requester {
+	base.limits = &limits
+	return base
+}
+
+// Client returns a copy of client whose responses are limited.
+func (limits Limits) Client(client *http.Client) *http.Client {
+	if client == nil {
+		client = &http.Client{}
+	}
+	limited := *client
+	limited.Transport = &LimitTransport{Base: client.Transport, Limits: limits}
+	return &limited
+}
+
+// LimitTransport applies Limits to the responses of Base. When Base is an
+// *http.Transport a clone that stops reading oversized headers is kept for
+// the lifetime of the LimitTransport.
+type LimitTransport struct {
+	Base   http.RoundTripper
+	Limits Limits
+
+	mu          sync.Mutex
+	limitedFrom *http.Transport
+	limited     *http.Transport
+}
+
+func (transport *LimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := transport.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t, ok := base.(*http.Transport); ok && transport.Limits.MaxHeaderSize > 0 {
+		base = transport.headerLimited(t)
+	}
+	response, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, transport.Limits.mapError(err)
+	}
+	if err := transport.Limits.apply(response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// headerLimited makes the transport abort while reading oversized headers
+// instead of after, the clone is reused to keep its connection pool.
+func (transport *LimitTransport) headerLimited(base *http.Transport) *http.Transport {
+	size := transport.Limits.MaxHeaderSize
+	if base.MaxResponseHeaderBytes > 0 && base.MaxResponseHeaderBytes <= size {
+		return base
+	}
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if transport.limitedFrom != base || transport.limited.MaxResponseHeaderBytes != size {
+		if transport.limited != nil {
+			transport.limited.CloseIdleConnections()
+		}
+		transport.limitedFrom = base
+		transport.limited = base.Clone()
+		transport.limited.MaxResponseHeaderBytes = size
+	}
+	return transport.limited
+}
+
+// mapError turns the untyped header limit error of net/http into a LimitError.
+func (limits Limits) mapError(err error) error {
+	if limits.MaxHeaderSize > 0 && strings.Contains(err.Error(), "server response headers exceeded") {
+		return &LimitError{Kind: HeaderSizeLimit, Limit: limits.MaxHeaderSize}
+	}
+	return err
+}
+
+func (limits Limits) apply(response *http.Response) error {
+	if limits.MaxHeaderSize > 0 && headerSize(response.Header) > limits.MaxHeaderSize {
+		response.Body.Close()
+		return &LimitError{Kind: HeaderSizeLimit, Limit: limits.MaxHeaderSize}
+	}
+	if limits.MaxBodySize > 0 && response.ContentLength > limits.MaxBodySize {
+		response.Body.Close()
+		return &LimitError{Kind: BodySizeLimit, Limit: limits.MaxBodySize}
+	}
+	if response.Body != nil && response.Body != http.NoBody &&
+		(limits.MaxBodySize > 0 || limits.IdleTimeout > 0 || limits.MinThroughput > 0) {
+		response.Body = newLimitedBody(response.Body, limits)
+	}
+	return nil
+}
+
+func headerSize(header http.Header) (size int64) {
+	for key, values := range header {
+		for _, value := range values {
+			// "Key: value\r\n"
+			size += int64(len(key) + len(value) + 4)
+		}
+	}
+	return
+}
+
+// limitedBody enforces the body limits while it is read. The idle timer
+// closes the underlying body so a blocked Read returns.
+type limitedBody struct {
+	io.ReadCloser
+	limits Limits
+	read   int64
+	// reading only counts the time spent in Read, a caller pausing between
+	// reads does not lower the throughput
+	reading time.Duration
+	timer   *time.Timer
+
+	mu       sync.Mutex
+	breached error
+}
+
+func newLimitedBody(body io.ReadCloser, limits Limits) *limitedBody {
+	limited := &limitedBody{ReadCloser: body, limits: limits}
+	if limits.ThroughputWindow <= 0 {
+		limited.limits.ThroughputWindow = time.Second
+	}
+	return limited
+}
+
+func (body *limitedBody) Read(p []byte) (int, error) {
+	if err := body.err(); err != nil {
+		return 0, err
+	}
+	if limit := body.limits.MaxBodySize; limit > 0 && int64(len(p)) > limit-body.read+1 {
+		p = p[:limit-body.read+1]
+	}
+
+	if body.limits.IdleTimeout > 0 {
+		if body.timer == nil {
+			body.timer = time.AfterFunc(body.limits.IdleTimeout, body.expire)
+		} else {
+			body.timer.Reset(body.limits.IdleTimeout)
+		}
+	}
+	started := time.Now()
+	n, err := body.ReadCloser.Read(p)
+	body.reading += time.Since(started)
+	if body.timer != nil {
+		body.timer.Stop()
+	}
+	body.read += int64(n)
+
+	if breached := body.err(); breached != nil {
+		return n, breached
+	}
+	if limit := body.limits.MaxBodySize; limit > 0 && body.read > limit {
+		return body.breach(n-int(body.read-limit), &LimitError{Kind: BodySizeLimit, Limit: limit})
+	}
+	if limit := body.limits.MinThroughput; limit > 0 && err == nil {
+		if elapsed := body.reading; elapsed >= body.limits.ThroughputWindow &&
+			float64(body.read)/elapsed.Seconds() < float64(limit) {
+			return body.breach(n, &LimitError{Kind: ThroughputLimit, Limit: limit})
+		}
+	}
+	return n, err
+}
+
+func (body *limitedBody) expire() {
+	body.mu.Lock()
+	if body.breached == nil {
+		body.breached = &LimitError{Kind: IdleReadLimit, Timeout: body.limits.IdleTimeout}
+	}
+	body.mu.Unlock()
+	body.ReadCloser.Close()
+}
+
+func (body *limitedBody) breach(n int, err error) (int, error) {
+	body.mu.Lock()
+	if body.breached == nil {
+		body.breached = err
+	}
+	err = body.breached
+	body.mu.Unlock()
+	body.ReadCloser.Close()
+	return n, err
+}
+
+func (body *limitedBody) err() error {
+	body.mu.Lock()
+	defer body.mu.Unlock()
+	return body.breached
+}
+
+func (body *limitedBody) Close() error {
+	if body.timer != nil {
+		body.timer.Stop()
+	}
+	return body.ReadCloser.Close()
+}
@@ -0,0 +1,126 @@
+package bunker
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	apperr "github.com/yudhiana/bunker/errors"
+)
+
+func TestLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			_, _ = io.WriteString(w, strings.Repeat("a", 1024))
+		case "/stream":
+			w.(http.Flusher).Flush()
+			_, _ = io.WriteString(w, strings.Repeat("a", 1024))
+		case "/headers":
+			w.Header().Set("X-Large", strings.Repeat("h", 2048))
+		case "/slow":
+			w.(http.Flusher).Flush()
+			for i := 0; i < 20; i++ {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(50 * time.Millisecond):
+				}
+				_, _ = io.WriteString(w, "a")
+				w.(http.Flusher).Flush()
+			}
+		case "/stall":
+			_, _ = io.WriteString(w, "a")
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+		default:
+			_, _ = io.WriteString(w, "ok")
+		}
+	}))
+	defer server.Close()
+
+	limitErr := func(t *testing.T, err error, kind LimitKind, code apperr.AppErrorCode) {
+		t.Helper()
+		var limit *LimitError
+		if !errors.As(err, &limit) || limit.Kind != kind {
+			t.Fatalf("invalid limit error\n\tExpected : %v\n\tActual : %v", kind, err)
+		}
+		if appErr := limit.ApplicationError(); appErr.Code != code || appErr.Error != limit {
+			t.Errorf("invalid application error %+v", appErr)
+		}
+		if apperr.New(code).Error != nil {
+			t.Error("the shared application error must not be modified")
+		}
+	}
+
+	t.Run("testBodySize", func(t *testing.T) {
+		req := New(server.URL).AddPath("large").SetLimits(Limits{MaxBodySize: 100}).Get().Do()
+		limitErr(t, req.Err(), BodySizeLimit, apperr.StatusRequestEntityTooLarge)
+
+		req = New(server.URL).AddPath("stream").SetLimits(Limits{MaxBodySize: 100}).Get().Do()
+		body, err := io.ReadAll(req.Response.Body)
+		if len(body) != 100 {
+			t.Errorf("invalid body size\n\tExpected : %v\n\tActual : %v", 100, len(body))
+		}
+		limitErr(t, err, BodySizeLimit, apperr.StatusRequestEntityTooLarge)
+
+		req = New(server.URL).SetLimits(Limits{MaxBodySize: 100}).Get().Do()
+		if body, err := io.ReadAll(req.Response.Body); err != nil || string(body) != "ok" {
+			t.Errorf("invalid body %q %v", body, err)
+		}
+	})
+
+	t.Run("testHeaderSize", func(t *testing.T) {
+		req := New(server.URL).AddPath("headers").SetLimits(Limits{MaxHeaderSize: 1024}).Get().Do()
+		limitErr(t, req.Err(), HeaderSizeLimit, apperr.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("testIdleTimeout", func(t *testing.T) {
+		req := New(server.URL).AddPath("stall").SetLimits(Limits{IdleTimeout: 100 * time.Millisecond}).Get().Do()
+		started := time.Now()
+		_, err := io.ReadAll(req.Response.Body)
+		limitErr(t, err, IdleReadLimit, apperr.StatusRequestTimeout)
+		if elapsed := time.Since(started); elapsed > time.Second {
+			t.Errorf("idle read was not cut off after %v", elapsed)
+		}
+	})
+
+	t.Run("testMinThroughput", func(t *testing.T) {
+		req := New(server.URL).AddPath("slow").SetLimits(Limits{MinThroughput: 100, ThroughputWindow: 200 * time.Millisecond}).Get().Do()
+		_, err := io.ReadAll(req.Response.Body)
+		limitErr(t, err, ThroughputLimit, apperr.StatusRequestTimeout)
+	})
+
+	t.Run("testDelayedReader", func(t *testing.T) {
+		body := newLimitedBody(io.NopCloser(strings.NewReader(strings.Repeat("a", 10<<10))), Limits{MinThroughput: 100000, ThroughputWindow: 100 * time.Millisecond})
+		time.Sleep(200 * time.Millisecond)
+		if _, err := io.ReadAll(body); err != nil {
+			t.Errorf("waiting before reading must not count as a slow body, got %v", err)
+		}
+	})
+
+	t.Run("testClient", func(t *testing.T) {
+		client := Limits{MaxBodySize: 100, MaxHeaderSize: 1024}.Client(server.Client())
+		req := New(server.URL).AddPath("large").SetClient(client).Get().Do()
+		limitErr(t, req.Err(), BodySizeLimit, apperr.StatusRequestEntityTooLarge)
+
+		req = New(server.URL).AddPath("headers").SetClient(client).Get().Do()
+		limitErr(t, req.Err(), HeaderSizeLimit, apperr.StatusRequestEntityTooLarge)
+
+		limited := client.Transport.(*LimitTransport).limited
+		req = New(server.URL).SetClient(client).Get().Do()
+		if req.HaveError() || req.Response.StatusCode != http.StatusOK {
+			t.Errorf("invalid response %v", req.Errors)
+		}
+		if client.Transport.(*LimitTransport).limited != limited {
+			t.Errorf("the header limited transport must be reused")
+		}
+	})
+}
@@ -0,0 +1,335 @@
+package bunker
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RequestInfo labels the request a metrics hook is called for.
+type RequestInfo struct {
+	Host    string
+	Method  string
+	Route   string
+	Attempt int
+	// Endpoint is the endpoint chosen by the pool, empty without one.
+	Endpoint string
+}
+
+// Metrics is called by Do for every attempt.
+type Metrics interface {
+	OnStart(info RequestInfo)
+	OnFinish(info RequestInfo, status int, duration time.Duration)
+	OnError(info RequestInfo, err error, duration time.Duration)
+	OnRetry(info RequestInfo)
+	OnBytesSent(info RequestInfo, size int64)
+	OnBytesReceived(info RequestInfo, size int64)
+}
+
+func (base *Requester) SetMetrics(metrics Metrics) *Requester {
+	base.metrics = metrics
+	return base
+}
+
+func (base *Requester) requestInfo() RequestInfo {
+	return RequestInfo{
+		Host:     base.Request.URL.Host,
+		Method:   base.Method,
+		Route:    base.route(),
+		Attempt:  base.attempt,
+		Endpoint: base.endpoint,
+	}
+}
+
+// route is the low cardinality label of the request path.
+func (base *Requester) route() string {
+	if route, _ := base.pathTemplate(); route != "" {
+		return route
+	}
+	if base.Request != nil && base.Request.URL.Path != "" {
+		return base.Request.URL.Path
+	}
+	return "/"
+}
+
+func (base *Requester) metricsStart() RequestInfo {
+	if base.metrics == nil {
+		return RequestInfo{}
+	}
+	info := base.requestInfo()
+	if base.attempt > 1 {
+		base.metrics.OnRetry(info)
+	}
+	base.metrics.OnStart(info)
+	if base.Request.ContentLength > 0 {
+		base.metrics.OnBytesSent(info, base.Request.ContentLength)
+	}
+	return info
+}
+
+func (base *Requester) metricsEnd(info RequestInfo, response *http.Response, err error, duration time.Duration) {
+	if base.metrics == nil {
+		return
+	}
+	if err != nil {
+		base.metrics.OnError(info, err, duration)
+		return
+	}
+	base.metrics.OnFinish(info, response.StatusCode, duration)
+	if response.Body != nil && response.Body != http.NoBody {
+		response.Body = &countingBody{ReadCloser: response.Body, done: func(size int64) {
+			base.metrics.OnBytesReceived(info, size)
+		}}
+	}
+}
+
+// countingBody reports the number of bytes read once the body hits EOF or is closed.
+type countingBody struct {
+	io.ReadCloser
+	size     int64
+	reported bool
+	done     func(size int64)
+}
+
+func (body *countingBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.size += int64(n)
+	if err == io.EOF {
+		body.report()
+	}
+	return n, err
+}
+
+func (body *countingBody) Close() error {
+	body.report()
+	return body.ReadCloser.Close()
+}
+
+func (body *countingBody) report() {
+	if !body.reported {
+		body.reported = true
+		body.done(body.size)
+	}
+}
+
+// DefaultBuckets are the latency histogram buckets in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// OtherRoute replaces routes once PrometheusOptions.MaxRoutes is reached.
+const OtherRoute string = "other"
+
+type PrometheusOptions struct {
+	Namespace string
+	Buckets   []float64
+	// MaxRoutes caps the distinct route label values, 0 means 100.
+	MaxRoutes int
+}
+
+// PrometheusMetrics implements Metrics and serves the Prometheus text format.
+type PrometheusMetrics struct {
+	mu        sync.Mutex
+	namespace string
+	buckets   []float64
+	maxRoutes int
+	routes    map[string]bool
+
+	requests      map[string]float64
+	errors        map[string]float64
+	retries       map[string]float64
+	bytesSent     map[string]float64
+	bytesReceived map[string]float64
+	inFlight      map[string]float64
+	durations     map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func NewPrometheusMetrics(options PrometheusOptions) *PrometheusMetrics {
+	buckets := append([]float64(nil), options.Buckets...)
+	if len(buckets) == 0 {
+		buckets = append(buckets, DefaultBuckets...)
+	}
+	sort.Float64s(buckets)
+	namespace := options.Namespace
+	if namespace == "" {
+		namespace = "gorest"
+	}
+	maxRoutes := options.MaxRoutes
+	if maxRoutes <= 0 {
+		maxRoutes = 100
+	}
+	return &PrometheusMetrics{
+		namespace:     namespace,
+		buckets:       buckets,
+		maxRoutes:     maxRoutes,
+		routes:        make(map[string]bool),
+		requests:      make(map[string]float64),
+		errors:        make(map[string]float64),
+		retries:       make(map[string]float64),
+		bytesSent:     make(map[string]float64),
+		bytesReceived: make(map[string]float64),
+		inFlight:      make(map[string]float64),
+		durations:     make(map[string]*histogram),
+	}
+}
+
+// labels must be called with the lock held.
+func (pm *PrometheusMetrics) labels(info RequestInfo, extra ...string) string {
+	route := info.Route
+	if !pm.routes[route] {
+		if len(pm.routes) >= pm.maxRoutes {
+			route = OtherRoute
+		} else {
+			pm.routes[route] = true
+		}
+	}
+	pairs := []string{"host", info.Host, "method", info.Method, "route", route}
+	return formatLabels(append(pairs, extra...))
+}
+
+func (pm *PrometheusMetrics) OnStart(info RequestInfo) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.inFlight[formatLabels([]string{"host", info.Host})]++
+}
+
+func (pm *PrometheusMetrics) OnFinish(info RequestInfo, status int, duration time.Duration) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.inFlight[formatLabels([]string{"host", info.Host})]--
+	pm.requests[pm.labels(info, "status", strconv.Itoa(status))]++
+	pm.observe(pm.labels(info), duration)
+}
+
+func (pm *PrometheusMetrics) OnError(info RequestInfo, err error, duration time.Duration) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.inFlight[formatLabels([]string{"host", info.Host})]--
+	pm.errors[pm.labels(info)]++
+	pm.observe(pm.labels(info), duration)
+}
+
+func (pm *PrometheusMetrics) OnRetry(info RequestInfo) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.retries[pm.labels(info)]++
+}
+
+func (pm *PrometheusMetrics) OnBytesSent(info RequestInfo, size int64) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.bytesSent[pm.labels(info)] += float64(size)
+}
+
+func (pm *PrometheusMetrics) OnBytesReceived(info RequestInfo, size int64) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.bytesReceived[pm.labels(info)] += float64(size)
+}
+
+func (pm *PrometheusMetrics) observe(labels string, duration time.Duration) {
+	h, found := pm.durations[labels]
+	if !found {
+		h = &histogram{counts: make([]uint64, len(pm.buckets))}
+		pm.durations[labels] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range pm.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+func (pm *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = pm.WriteTo(w)
+}
+
+// WriteTo renders every metric in the Prometheus text exposition format.
+func (pm *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	var out strings.Builder
+	pm.writeSamples(&out, "requests_total", "counter", "Completed requests by status.", pm.requests)
+	pm.writeSamples(&out, "request_errors_total", "counter", "Requests that failed without a response.", pm.errors)
+	pm.writeSamples(&out, "request_retries_total", "counter", "Repeated attempts of a requester.", pm.retries)
+	pm.writeSamples(&out, "request_bytes_total", "counter", "Request body bytes sent.", pm.bytesSent)
+	pm.writeSamples(&out, "response_bytes_total", "counter", "Response body bytes received.", pm.bytesReceived)
+	pm.writeSamples(&out, "requests_in_flight", "gauge", "Requests waiting for a response.", pm.inFlight)
+	pm.writeHistogram(&out)
+
+	n, err := io.WriteString(w, out.String())
+	return int64(n), err
+}
+
+func (pm *PrometheusMetrics) writeSamples(out *strings.Builder, name, kind, help string, samples map[string]float64) {
+	if len(samples) == 0 {
+		return
+	}
+	name = pm.namespace + "_" + name
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, labels := range sortedKeys(samples) {
+		fmt.Fprintf(out, "%s{%s} %s\n", name, labels, formatFloat(samples[labels]))
+	}
+}
+
+func (pm *PrometheusMetrics) writeHistogram(out *strings.Builder) {
+	if len(pm.durations) == 0 {
+		return
+	}
+	name := pm.namespace + "_request_duration_seconds"
+	fmt.Fprintf(out, "# HELP %s Request latency.\n# TYPE %s histogram\n", name, name)
+	for _, labels := range sortedKeys(pm.durations) {
+		h := pm.durations[labels]
+		for i, bound := range pm.buckets {
+			fmt.Fprintf(out, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(bound), h.counts[i])
+		}
+		fmt.Fprintf(out, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		fmt.Fprintf(out, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+		fmt.Fprintf(out, "%s_count{%s} %d\n", name, labels, h.count)
+	}
+}
+
+func sortedKeys[V any](samples map[string]V) []string {
+	keys := make([]string, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatLabels(pairs []string) string {
+	labels := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		labels = append(labels, pairs[i]+`="`+escapeLabel(pairs[i+1])+`"`)
+	}
+	return strings.Join(labels, ",")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
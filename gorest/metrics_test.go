@@ -0,0 +1,63 @@
+package bunker
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = io.WriteString(w, "hello")
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	metrics := NewPrometheusMetrics(PrometheusOptions{Buckets: []float64{1, 0.5}, MaxRoutes: 2})
+
+	req := New(server.URL).Post().AddPath("/users").SetPayload("abc").SetMetrics(metrics).Do()
+	_, _ = io.ReadAll(req.Response.Body)
+	req.Response.Body.Close()
+	req.Do()
+	New(server.URL).Get().AddPath("/fail").SetMetrics(metrics).Do()
+	New(server.URL).Get().AddPath("/third").SetMetrics(metrics).Do()
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	New(closed.URL).Get().AddPath("/users").SetMetrics(metrics).Do()
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest(GET, "/metrics", nil))
+	output := recorder.Body.String()
+
+	expected := []string{
+		`# TYPE gorest_requests_total counter`,
+		`gorest_requests_total{host="` + host + `",method="POST",route="/users",status="200"} 2`,
+		`gorest_requests_total{host="` + host + `",method="GET",route="/fail",status="500"} 1`,
+		`gorest_requests_total{host="` + host + `",method="GET",route="other",status="200"} 1`,
+		`gorest_request_errors_total{host="` + strings.TrimPrefix(closed.URL, "http://") + `",method="GET",route="/users"} 1`,
+		`gorest_request_retries_total{host="` + host + `",method="POST",route="/users"} 1`,
+		`gorest_request_bytes_total{host="` + host + `",method="POST",route="/users"} 6`,
+		`gorest_response_bytes_total{host="` + host + `",method="POST",route="/users"} 5`,
+		`gorest_request_duration_seconds_bucket{host="` + host + `",method="POST",route="/users",le="0.5"} 2`,
+		`gorest_request_duration_seconds_bucket{host="` + host + `",method="POST",route="/users",le="+Inf"} 2`,
+		`gorest_request_duration_seconds_count{host="` + host + `",method="POST",route="/users"} 2`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("missing metric\n\tExpected : %v\n\tActual : %v", line, output)
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	expected := `a\"b\\c\n`
+	if actual := escapeLabel("a\"b\\c\n"); actual != expected {
+		t.Errorf("invalid label\n\tExpected : %v\n\tActual : %v", expected, actual)
+	}
+}
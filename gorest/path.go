@@ -0,0 +1,123 @@
+package bunker
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type pathPart struct {
+	value    string
+	template bool
+}
+
+// SetPath replaces the request path with a template such as
+// "/users/{id}/orders/{orderID}", placeholders are filled by PathParam.
+func (base *Requester) SetPath(template string) *Requester {
+	base.paths = []pathPart{{value: template, template: true}}
+	return base
+}
+
+// PathParam fills a placeholder of the path template, the value is escaped as
+// a single path segment. Empty, "." and ".." values are refused by Do.
+func (base *Requester) PathParam(name, value string) *Requester {
+	base.pathParams[name] = value
+	return base
+}
+
+func (base *Requester) PathParams(params map[string]string) *Requester {
+	for name, value := range params {
+		base.PathParam(name, value)
+	}
+	return base
+}
+
+// expandPath joins the base url path with the added paths and returns the
+// escaped result.
+func (base *Requester) expandPath(basePath string) (string, error) {
+	result := basePath
+	for _, part := range base.paths {
+		if !part.template {
+			result = joinPath(result, (&url.URL{Path: part.value}).EscapedPath())
+			continue
+		}
+		expanded, err := expandTemplate(part.value, base.pathParams)
+		if err != nil {
+			return "", err
+		}
+		result = joinPath(result, expanded)
+	}
+	return result, nil
+}
+
+func (base *Requester) setRequestPath(u *url.URL) error {
+	if len(base.paths) == 0 {
+		return nil
+	}
+	escaped, err := base.expandPath(u.EscapedPath())
+	if err != nil {
+		return err
+	}
+	unescaped, err := url.PathUnescape(escaped)
+	if err != nil {
+		return err
+	}
+	u.Path = unescaped
+	u.RawPath = escaped
+	return nil
+}
+
+// pathTemplate is the path with placeholders left in place, it is the route
+// label used by logs, traces and metrics.
+func (base *Requester) pathTemplate() (route string, templated bool) {
+	for _, part := range base.paths {
+		route = joinPath(route, part.value)
+		templated = templated || part.template
+	}
+	return route, templated
+}
+
+func expandTemplate(template string, params map[string]string) (string, error) {
+	var out strings.Builder
+	rest := template
+	for {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			if strings.IndexByte(rest, '}') >= 0 {
+				return "", fmt.Errorf("unexpected '}' in path template %q", template)
+			}
+			out.WriteString((&url.URL{Path: rest}).EscapedPath())
+			return out.String(), nil
+		}
+		closing := strings.IndexByte(rest[open:], '}')
+		if closing < 0 {
+			return "", fmt.Errorf("unclosed placeholder in path template %q", template)
+		}
+		name := rest[open+1 : open+closing]
+		value, found := params[name]
+		if name == "" || !found {
+			return "", fmt.Errorf("path parameter {%s} of %q has no value", name, template)
+		}
+		// escaping leaves these alone and they would change the path itself
+		if value == "" || value == "." || value == ".." {
+			return "", fmt.Errorf("path parameter {%s} of %q can't be %q", name, template, value)
+		}
+		out.WriteString((&url.URL{Path: rest[:open]}).EscapedPath())
+		out.WriteString(url.PathEscape(value))
+		rest = rest[open+closing+1:]
+	}
+}
+
+// joinPath concatenates two escaped paths with exactly one slash between them.
+func joinPath(left, right string) string {
+	if right == "" {
+		return left
+	}
+	if left == "" {
+		if strings.HasPrefix(right, "/") {
+			return right
+		}
+		return "/" + right
+	}
+	return strings.TrimRight(left, "/") + "/" + strings.TrimLeft(right, "/")
+}
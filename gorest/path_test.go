@@ -0,0 +1,73 @@
+package bunker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPathTemplate(t *testing.T) {
+	var requestURI string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURI = r.RequestURI
+	}))
+	defer server.Close()
+
+	t.Run("testEscapedParams", func(t *testing.T) {
+		req := New(server.URL+"/api/").Get().SetPath("/users/{id}/orders/{orderID}").
+			PathParam("id", "a/b c").PathParam("orderID", "42").Do()
+		if req.HaveError() {
+			t.Fatal(req.Errors)
+		}
+		expected := "/api/users/a%2Fb%20c/orders/42"
+		if requestURI != expected {
+			t.Errorf("invalid path\n\tExpected : %v\n\tActual : %v", expected, requestURI)
+		}
+		if req.route() != "/users/{id}/orders/{orderID}" {
+			t.Errorf("invalid route %v", req.route())
+		}
+	})
+
+	t.Run("testAddPathJoins", func(t *testing.T) {
+		New(server.URL + "/api").Get().AddPath("v1/").AddPath("/users").Do()
+		expected := "/api/v1/users"
+		if requestURI != expected {
+			t.Errorf("invalid path\n\tExpected : %v\n\tActual : %v", expected, requestURI)
+		}
+	})
+
+	t.Run("testMissingParam", func(t *testing.T) {
+		requestURI = ""
+		req := New(server.URL).Get().SetPath("/users/{id}").Do()
+		if !req.HaveError() || requestURI != "" {
+			t.Error("unfilled placeholder must fail before sending")
+		}
+	})
+
+	t.Run("testDotSegmentParams", func(t *testing.T) {
+		for _, value := range []string{"", ".", ".."} {
+			requestURI = ""
+			req := New(server.URL).Get().SetPath("/users/{id}/orders").PathParam("id", value).Do()
+			if !req.HaveError() || requestURI != "" {
+				t.Errorf("path parameter %q must fail before sending", value)
+			}
+		}
+	})
+}
+
+func TestJoinPath(t *testing.T) {
+	cases := map[[2]string]string{
+		{"", "users"}:        "/users",
+		{"/api/", "/users"}:  "/api/users",
+		{"/api", "users/"}:   "/api/users/",
+		{"/api", ""}:         "/api",
+		{"", "/users/{id}"}:  "/users/{id}",
+		{"/a//", "//b"}:      "/a/b",
+		{"/", "orders/{id}"}: "/orders/{id}",
+	}
+	for input, expected := range cases {
+		if actual := joinPath(input[0], input[1]); actual != expected {
+			t.Errorf("invalid join of %v\n\tExpected : %v\n\tActual : %v", input, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package bunker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Strategy int
+
+const (
+	RoundRobin Strategy = iota
+	LeastInFlight
+	// Weighted spreads requests by Endpoint.Weight with smooth weighted
+	// round-robin.
+	Weighted
+	// PrimaryFailover sends to the first healthy endpoint in pool order.
+	PrimaryFailover
+)
+
+const (
+	DefaultMaxFailures = 3
+	DefaultCoolDown    = 30 * time.Second
+)
+
+type Endpoint struct {
+	// URL replaces the BaseUrl of the requester, paths are added to it.
+	URL string
+	// Weight is used by Weighted, it defaults to 1.
+	Weight int
+}
+
+// HealthCheck polls every endpoint, an endpoint failing its check receives no
+// traffic until a check succeeds again.
+type HealthCheck struct {
+	Path     string
+	Interval time.Duration
+	// Timeout defaults to Interval.
+	Timeout time.Duration
+	Client  *http.Client
+	// Healthy defaults to a 2xx status.
+	Healthy func(response *http.Response) bool
+}
+
+type PoolOptions struct {
+	Strategy Strategy
+	// MaxFailures consecutive failures eject an endpoint for CoolDown.
+	MaxFailures int
+	CoolDown    time.Duration
+	// IsFailure defaults to an error or a 5xx status.
+	IsFailure   func(response *http.Response, err error) bool
+	HealthCheck *HealthCheck
+}
+
+type EndpointStatus struct {
+	URL          string
+	Healthy      bool
+	InFlight     int
+	Failures     int
+	EjectedUntil time.Time
+}
+
+// EndpointPool picks the endpoint of every Do of the requesters it is set on.
+// A request that could not connect is sent again to the next endpoint.
+type EndpointPool struct {
+	mu        sync.Mutex
+	options   PoolOptions
+	endpoints []*poolEndpoint
+	next      int
+	now       func() time.Time
+}
+
+type poolEndpoint struct {
+	Endpoint
+	inFlight      int
+	failures      int
+	ejectedUntil  time.Time
+	down          bool
+	currentWeight int
+}
+
+func NewEndpointPool(endpoints []Endpoint, options PoolOptions) *EndpointPool {
+	if options.MaxFailures <= 0 {
+		options.MaxFailures = DefaultMaxFailures
+	}
+	if options.CoolDown <= 0 {
+		options.CoolDown = DefaultCoolDown
+	}
+	if options.IsFailure == nil {
+		options.IsFailure = func(response *http.Response, err error) bool {
+			return err != nil || response.StatusCode >= http.StatusInternalServerError
+		}
+	}
+	pool := &EndpointPool{options: options, now: time.Now}
+	for _, endpoint := range endpoints {
+		if endpoint.Weight <= 0 {
+			endpoint.Weight = 1
+		}
+		endpoint.URL = strings.TrimSuffix(endpoint.URL, "/")
+		pool.endpoints = append(pool.endpoints, &poolEndpoint{Endpoint: endpoint})
+	}
+	return pool
+}
+
+// New returns a requester sending through the pool.
+func (pool *EndpointPool) New() *Requester {
+	return New("").SetEndpointPool(pool)
+}
+
+func (base *Requester) SetEndpointPool(pool *EndpointPool) *Requester {
+	base.pool = pool
+	return base
+}
+
+// Endpoint returns the endpoint URL the last Do was sent to.
+func (base *Requester) Endpoint() string {
+	return base.endpoint
+}
+
+var ErrNoEndpoint = errors.New("endpoint pool is empty")
+
+// pick chooses among the endpoints not tried by this Do yet. When every
+// endpoint is ejected the pool still picks one rather than failing.
+func (pool *EndpointPool) pick(tried map[string]bool) (string, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	now := pool.now()
+	var candidates []*poolEndpoint
+	for _, endpoint := range pool.endpoints {
+		if !tried[endpoint.URL] && !endpoint.down && !endpoint.ejectedUntil.After(now) {
+			candidates = append(candidates, endpoint)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, endpoint := range pool.endpoints {
+			if !tried[endpoint.URL] {
+				candidates = append(candidates, endpoint)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return "", ErrNoEndpoint
+	}
+
+	var chosen *poolEndpoint
+	switch pool.options.Strategy {
+	case PrimaryFailover:
+		chosen = candidates[0]
+	case LeastInFlight:
+		offset := pool.next
+		pool.next++
+		for i := range candidates {
+			candidate := candidates[(offset+i)%len(candidates)]
+			if chosen == nil || candidate.inFlight < chosen.inFlight {
+				chosen = candidate
+			}
+		}
+	case Weighted:
+		total := 0
+		for _, candidate := range candidates {
+			candidate.currentWeight += candidate.Weight
+			total += candidate.Weight
+			if chosen == nil || candidate.currentWeight > chosen.currentWeight {
+				chosen = candidate
+			}
+		}
+		chosen.currentWeight -= total
+	default:
+		chosen = candidates[pool.next%len(candidates)]
+		pool.next++
+	}
+	return chosen.URL, nil
+}
+
+func (pool *EndpointPool) find(url string) *poolEndpoint {
+	for _, endpoint := range pool.endpoints {
+		if endpoint.URL == url {
+			return endpoint
+		}
+	}
+	return nil
+}
+
+func (pool *EndpointPool) start(url string) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if endpoint := pool.find(url); endpoint != nil {
+		endpoint.inFlight++
+	}
+}
+
+// finish does the passive health tracking. An endpoint back from its cool
+// down is ejected again by its next failure.
+func (pool *EndpointPool) finish(url string, response *http.Response, err error) {
+	failed := pool.options.IsFailure(response, err)
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	endpoint := pool.find(url)
+	if endpoint == nil {
+		return
+	}
+	endpoint.inFlight--
+	if !failed {
+		endpoint.failures = 0
+		return
+	}
+	endpoint.failures++
+	if endpoint.failures >= pool.options.MaxFailures {
+		endpoint.ejectedUntil = pool.now().Add(pool.options.CoolDown)
+		endpoint.failures = pool.options.MaxFailures - 1
+	}
+}
+
+func (pool *EndpointPool) Status() []EndpointStatus {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	now := pool.now()
+	status := make([]EndpointStatus, len(pool.endpoints))
+	for i, endpoint := range pool.endpoints {
+		status[i] = EndpointStatus{
+			URL:          endpoint.URL,
+			Healthy:      !endpoint.down && !endpoint.ejectedUntil.After(now),
+			InFlight:     endpoint.inFlight,
+			Failures:     endpoint.failures,
+			EjectedUntil: endpoint.ejectedUntil,
+		}
+	}
+	return status
+}
+
+// CheckHealth runs one round of the active health check.
+func (pool *EndpointPool) CheckHealth(ctx context.Context) {
+	check := pool.options.HealthCheck
+	if check == nil {
+		return
+	}
+	client := check.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = check.Interval
+	}
+	healthy := check.Healthy
+	if healthy == nil {
+		healthy = func(response *http.Response) bool {
+			return response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices
+		}
+	}
+
+	pool.mu.Lock()
+	urls := make([]string, len(pool.endpoints))
+	for i, endpoint := range pool.endpoints {
+		urls[i] = endpoint.URL
+	}
+	pool.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, url := range urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithCancel(ctx)
+			if timeout > 0 {
+				checkCtx, cancel = context.WithTimeout(ctx, timeout)
+			}
+			defer cancel()
+			up := false
+			if request, err := http.NewRequestWithContext(checkCtx, GET, url+check.Path, nil); err == nil {
+				if response, err := client.Do(request); err == nil {
+					up = healthy(response)
+					response.Body.Close()
+				}
+			}
+			pool.mu.Lock()
+			if endpoint := pool.find(url); endpoint != nil {
+				endpoint.down = !up
+				if up {
+					endpoint.failures, endpoint.ejectedUntil = 0, time.Time{}
+				}
+			}
+			pool.mu.Unlock()
+		}(url)
+	}
+	wg.Wait()
+}
+
+// StartHealthChecks checks the endpoints every HealthCheck.Interval until ctx
+// is done.
+func (pool *EndpointPool) StartHealthChecks(ctx context.Context) {
+	check := pool.options.HealthCheck
+	if check == nil || check.Interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(check.Interval)
+		defer ticker.Stop()
+		pool.CheckHealth(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pool.CheckHealth(ctx)
+			}
+		}
+	}()
+}
+
+// failover reports whether the request is sent again to another endpoint,
+// only when it could not connect so the server has not seen it.
+func (base *Requester) failover(err error) bool {
+	if base.pool == nil {
+		return false
+	}
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "dial" {
+		return false
+	}
+	base.triedEndpoints[base.endpoint] = true
+	base.pool.mu.Lock()
+	defer base.pool.mu.Unlock()
+	for _, endpoint := range base.pool.endpoints {
+		if !base.triedEndpoints[endpoint.URL] {
+			return true
+		}
+	}
+	return false
+}
+
+// requestBaseURL picks the endpoint when the requester has a pool.
+func (base *Requester) requestBaseURL() (string, error) {
+	if base.pool == nil {
+		return base.BaseUrl, nil
+	}
+	endpoint, err := base.pool.pick(base.triedEndpoints)
+	base.endpoint = endpoint
+	return endpoint, err
+}
+
+func (base *Requester) endpointStart() {
+	if base.pool != nil {
+		base.pool.start(base.endpoint)
+	}
+}
+
+func (base *Requester) endpointFinish(response *http.Response, err error) {
+	if base.pool != nil {
+		base.pool.finish(base.endpoint, response, err)
+	}
+}
@@ -0,0 +1,150 @@
+package bunker
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEndpointPool(t *testing.T) {
+	newServer := func(name string, status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			_, _ = io.WriteString(w, name+r.URL.Path)
+		}))
+	}
+	first := newServer("first", http.StatusOK)
+	defer first.Close()
+	second := newServer("second", http.StatusOK)
+	defer second.Close()
+	failing := newServer("failing", http.StatusServiceUnavailable)
+	defer failing.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	body := func(req *Requester) string {
+		if req.Response == nil {
+			return ""
+		}
+		data, _ := io.ReadAll(req.Response.Body)
+		return string(data)
+	}
+
+	t.Run("testRoundRobin", func(t *testing.T) {
+		pool := NewEndpointPool([]Endpoint{{URL: first.URL}, {URL: second.URL + "/"}}, PoolOptions{})
+		var got []string
+		for i := 0; i < 4; i++ {
+			got = append(got, body(pool.New().AddPath("items").Get().Do()))
+		}
+		expected := "first/items second/items first/items second/items"
+		if strings.Join(got, " ") != expected {
+			t.Errorf("invalid round robin\n\tExpected : %v\n\tActual : %v", expected, got)
+		}
+	})
+
+	t.Run("testWeighted", func(t *testing.T) {
+		pool := NewEndpointPool([]Endpoint{{URL: first.URL, Weight: 3}, {URL: second.URL}}, PoolOptions{Strategy: Weighted})
+		counts := make(map[string]int)
+		for i := 0; i < 8; i++ {
+			counts[pool.New().Get().Do().Endpoint()]++
+		}
+		if counts[first.URL] != 6 || counts[second.URL] != 2 {
+			t.Errorf("invalid weighted spread %v", counts)
+		}
+	})
+
+	t.Run("testLeastInFlight", func(t *testing.T) {
+		pool := NewEndpointPool([]Endpoint{{URL: first.URL}, {URL: second.URL}}, PoolOptions{Strategy: LeastInFlight})
+		pool.start(first.URL)
+		defer pool.finish(first.URL, &http.Response{StatusCode: http.StatusOK}, nil)
+		for i := 0; i < 3; i++ {
+			if endpoint := pool.New().Get().Do().Endpoint(); endpoint != second.URL {
+				t.Errorf("invalid endpoint\n\tExpected : %v\n\tActual : %v", second.URL, endpoint)
+			}
+		}
+	})
+
+	t.Run("testFailoverOnDialError", func(t *testing.T) {
+		pool := NewEndpointPool([]Endpoint{{URL: dead.URL}, {URL: first.URL}}, PoolOptions{Strategy: PrimaryFailover, MaxFailures: 1})
+		req := pool.New().AddPath("orders").Post().SetPayload(map[string]interface{}{"id": 1}).Do()
+		if req.HaveError() || body(req) != "first/orders" {
+			t.Errorf("request must fail over to the next endpoint, errors %v", req.Errors)
+		}
+		if status := pool.Status(); status[0].Healthy || !status[1].Healthy {
+			t.Errorf("dead endpoint must be ejected %+v", status)
+		}
+		if !strings.Contains(req.debug(), "ENDPOINT        : "+first.URL) {
+			t.Errorf("debug output must contain the endpoint")
+		}
+	})
+
+	t.Run("testNoFailoverOnResponse", func(t *testing.T) {
+		pool := NewEndpointPool([]Endpoint{{URL: failing.URL}, {URL: first.URL}}, PoolOptions{Strategy: PrimaryFailover})
+		req := pool.New().Get().Do()
+		if req.Response == nil || req.Response.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("a response must not be sent again to another endpoint")
+		}
+	})
+
+	t.Run("testAllEndpointsDown", func(t *testing.T) {
+		pool := NewEndpointPool([]Endpoint{{URL: dead.URL}}, PoolOptions{})
+		if req := pool.New().Get().Do(); !req.HaveError() {
+			t.Errorf("request must fail when no endpoint answers")
+		}
+		if req := pool.New().Get().Do(); !req.HaveError() || req.Endpoint() != dead.URL {
+			t.Errorf("ejected endpoints must still be used when none is healthy")
+		}
+	})
+
+	t.Run("testEjectionAndCoolDown", func(t *testing.T) {
+		now := time.Now()
+		pool := NewEndpointPool([]Endpoint{{URL: failing.URL}, {URL: first.URL}}, PoolOptions{Strategy: PrimaryFailover, MaxFailures: 2, CoolDown: time.Minute})
+		pool.now = func() time.Time { return now }
+
+		for i := 0; i < 2; i++ {
+			if endpoint := pool.New().Get().Do().Endpoint(); endpoint != failing.URL {
+				t.Fatalf("invalid endpoint before ejection %v", endpoint)
+			}
+		}
+		if endpoint := pool.New().Get().Do().Endpoint(); endpoint != first.URL {
+			t.Errorf("failing endpoint must be ejected, got %v", endpoint)
+		}
+
+		now = now.Add(time.Minute)
+		if endpoint := pool.New().Get().Do().Endpoint(); endpoint != failing.URL {
+			t.Errorf("endpoint must be re-admitted after the cool down, got %v", endpoint)
+		}
+		if endpoint := pool.New().Get().Do().Endpoint(); endpoint != first.URL {
+			t.Errorf("one failure after re-admission must eject again, got %v", endpoint)
+		}
+	})
+
+	t.Run("testHealthCheck", func(t *testing.T) {
+		var healthy atomic.Bool
+		checked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/health" && !healthy.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer checked.Close()
+
+		pool := NewEndpointPool([]Endpoint{{URL: checked.URL}, {URL: first.URL}}, PoolOptions{
+			Strategy:    PrimaryFailover,
+			HealthCheck: &HealthCheck{Path: "/health", Timeout: time.Second},
+		})
+		pool.CheckHealth(context.Background())
+		if endpoint := pool.New().Get().Do().Endpoint(); endpoint != first.URL {
+			t.Errorf("unhealthy endpoint must receive no traffic, got %v", endpoint)
+		}
+		healthy.Store(true)
+		pool.CheckHealth(context.Background())
+		if endpoint := pool.New().Get().Do().Endpoint(); endpoint != checked.URL {
+			t.Errorf("endpoint must receive traffic once healthy, got %v", endpoint)
+		}
+	})
+}
@@ -0,0 +1,248 @@
+package bunker
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QueryEncoder lets a type write its own query parameters under key.
+type QueryEncoder interface {
+	EncodeQuery(key string, values url.Values) error
+}
+
+var (
+	queryEncoderType  = reflect.TypeOf((*QueryEncoder)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+func (base *Requester) queryStruct(input interface{}) *Requester {
+	values, err := EncodeQuery(input)
+	if err != nil {
+		base.Errors = append(base.Errors, err)
+		return base
+	}
+	return base.queryValues(values)
+}
+
+// EncodeQuery turns a struct into query parameters using the query tag:
+//
+//	type Filter struct {
+//		IDs   []int     `query:"id"`                       // id=1&id=2
+//		Tags  []string  `query:"tags,comma"`               // tags=a,b
+//		From  time.Time `query:"from" layout:"2006-01-02"` // from=2022-10-03
+//		Until time.Time `query:"until,unix"`               // until=1664755200
+//		Page  *int      `query:"page,omitempty"`
+//		Token string    `query:"-"`
+//	}
+//
+// Embedded structs are flattened and nil pointers are skipped.
+func EncodeQuery(input interface{}) (url.Values, error) {
+	values := make(url.Values)
+	value := reflect.ValueOf(input)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return values, nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported query type %T", input)
+	}
+	return values, encodeQueryStruct(value, values)
+}
+
+type queryTag struct {
+	name      string
+	omitEmpty bool
+	comma     bool
+	unix      bool
+	layout    string
+}
+
+func parseQueryTag(field reflect.StructField) (queryTag, bool) {
+	tag, tagged := field.Tag.Lookup("query")
+	if tag == "-" {
+		return queryTag{}, false
+	}
+	options := strings.Split(tag, ",")
+	parsed := queryTag{name: options[0], layout: field.Tag.Get("layout")}
+	if !tagged || parsed.name == "" {
+		parsed.name = field.Name
+	}
+	for _, option := range options[1:] {
+		switch option {
+		case "omitempty":
+			parsed.omitEmpty = true
+		case "comma":
+			parsed.comma = true
+		case "unix":
+			parsed.unix = true
+		}
+	}
+	return parsed, true
+}
+
+func encodeQueryStruct(value reflect.Value, values url.Values) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		fieldValue := value.Field(i)
+
+		_, tagged := field.Tag.Lookup("query")
+		if field.Anonymous && !tagged {
+			for fieldValue.Kind() == reflect.Pointer {
+				if fieldValue.IsNil() {
+					break
+				}
+				fieldValue = fieldValue.Elem()
+			}
+			if fieldValue.Kind() == reflect.Struct && !isQueryScalar(fieldValue) {
+				if err := encodeQueryStruct(fieldValue, values); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		tag, include := parseQueryTag(field)
+		if !include {
+			continue
+		}
+		if err := encodeQueryField(tag, fieldValue, values); err != nil {
+			return fmt.Errorf("query field %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func encodeQueryField(tag queryTag, value reflect.Value, values url.Values) error {
+	if tag.omitEmpty && isEmptyQueryValue(value) {
+		return nil
+	}
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		if value.Kind() == reflect.Pointer && value.Type().Implements(queryEncoderType) {
+			break
+		}
+		value = value.Elem()
+	}
+
+	if encoder, isEncoder := asQueryEncoder(value); isEncoder {
+		return encoder.EncodeQuery(tag.name, values)
+	}
+
+	if (value.Kind() == reflect.Slice || value.Kind() == reflect.Array) && value.Type().Elem().Kind() != reflect.Uint8 {
+		items := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			item := value.Index(i)
+			for item.Kind() == reflect.Pointer || item.Kind() == reflect.Interface {
+				if item.IsNil() {
+					break
+				}
+				item = item.Elem()
+			}
+			if (item.Kind() == reflect.Pointer || item.Kind() == reflect.Interface) && item.IsNil() {
+				continue
+			}
+			formatted, err := formatQueryValue(tag, item)
+			if err != nil {
+				return err
+			}
+			items = append(items, formatted)
+		}
+		if tag.comma {
+			if len(items) > 0 {
+				values.Add(tag.name, strings.Join(items, ","))
+			}
+			return nil
+		}
+		for _, item := range items {
+			values.Add(tag.name, item)
+		}
+		return nil
+	}
+
+	formatted, err := formatQueryValue(tag, value)
+	if err != nil {
+		return err
+	}
+	values.Add(tag.name, formatted)
+	return nil
+}
+
+func asQueryEncoder(value reflect.Value) (QueryEncoder, bool) {
+	if value.Type().Implements(queryEncoderType) {
+		return value.Interface().(QueryEncoder), true
+	}
+	if value.CanAddr() && value.Addr().Type().Implements(queryEncoderType) {
+		return value.Addr().Interface().(QueryEncoder), true
+	}
+	return nil, false
+}
+
+func formatQueryValue(tag queryTag, value reflect.Value) (string, error) {
+	if value.Type() == timeType {
+		moment := value.Interface().(time.Time)
+		if tag.unix {
+			return strconv.FormatInt(moment.Unix(), 10), nil
+		}
+		if tag.layout != "" {
+			return moment.Format(tag.layout), nil
+		}
+		return moment.Format(time.RFC3339), nil
+	}
+	if value.Type().Implements(textMarshalerType) {
+		text, err := value.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+	if value.CanAddr() && value.Addr().Type().Implements(textMarshalerType) {
+		text, err := value.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 64), nil
+	case reflect.Slice:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return string(value.Bytes()), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported type of %s", value.Type())
+}
+
+// isQueryScalar reports struct types that are encoded as a single value.
+func isQueryScalar(value reflect.Value) bool {
+	if value.Type() == timeType || value.Type().Implements(textMarshalerType) || value.Type().Implements(queryEncoderType) {
+		return true
+	}
+	return value.CanAddr() && (value.Addr().Type().Implements(textMarshalerType) || value.Addr().Type().Implements(queryEncoderType))
+}
+
+func isEmptyQueryValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
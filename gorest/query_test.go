@@ -0,0 +1,86 @@
+package bunker
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type queryRange struct {
+	From, To int
+}
+
+func (r queryRange) EncodeQuery(key string, values url.Values) error {
+	values.Set(key, fmt.Sprintf("%d..%d", r.From, r.To))
+	return nil
+}
+
+type queryPaging struct {
+	Page  int `query:"page,omitempty"`
+	Limit int `query:"limit"`
+}
+
+type queryFilter struct {
+	queryPaging
+	IDs     []int     `query:"id"`
+	Tags    []string  `query:"tags,comma"`
+	From    time.Time `query:"from" layout:"2006-01-02"`
+	Until   time.Time `query:"until,unix"`
+	Owner   *string   `query:"owner"`
+	Status  *string   `query:"status,omitempty"`
+	Range   queryRange
+	Secret  string `query:"-"`
+	Deleted bool   `query:"deleted,omitempty"`
+	private string
+}
+
+func TestQuery(t *testing.T) {
+	t.Run("testRepeatedKeysFromString", func(t *testing.T) {
+		req := New("http://localhost").Query("id=1&id=2&name=x")
+		if actual := req.QueryData["id"]; len(actual) != 2 {
+			t.Errorf("invalid query\n\tExpected : [1 2]\n\tActual : %v", actual)
+		}
+	})
+
+	t.Run("testValues", func(t *testing.T) {
+		req := New("http://localhost").Query(url.Values{"a": {"1", "2"}}).Query(map[string][]string{"b": {"3"}})
+		expected := "a=1&a=2&b=3"
+		if actual := req.QueryData.Encode(); actual != expected {
+			t.Errorf("invalid query\n\tExpected : %v\n\tActual : %v", expected, actual)
+		}
+	})
+
+	t.Run("testStruct", func(t *testing.T) {
+		owner := "me"
+		from := time.Date(2022, 10, 3, 0, 0, 0, 0, time.UTC)
+		filter := queryFilter{
+			queryPaging: queryPaging{Limit: 10},
+			IDs:         []int{1, 2},
+			Tags:        []string{"a", "b"},
+			From:        from,
+			Until:       from,
+			Owner:       &owner,
+			Range:       queryRange{From: 1, To: 2},
+			Secret:      "hidden",
+			private:     "hidden",
+		}
+		req := New("http://localhost").Query(&filter)
+		if req.HaveError() {
+			t.Fatal(req.Errors)
+		}
+		expected := "Range=1..2&from=2022-10-03&id=1&id=2&limit=10&owner=me&tags=a%2Cb&until=1664755200"
+		if actual := req.QueryData.Encode(); actual != expected {
+			t.Errorf("invalid query\n\tExpected : %v\n\tActual : %v", expected, actual)
+		}
+	})
+
+	t.Run("testUnsupportedField", func(t *testing.T) {
+		req := New("http://localhost").Query(struct {
+			Nested map[string]string `query:"nested"`
+		}{Nested: map[string]string{"a": "b"}})
+		if !req.HaveError() {
+			t.Error("unsupported field must be reported")
+		}
+	})
+}
@@ -0,0 +1,171 @@
+package bunker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxRedirects redirects are followed, one more fails the request.
+const DefaultMaxRedirects = 10
+
+var (
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrRedirectRefused  = errors.New("redirect refused")
+)
+
+// RedirectPolicy controls which redirects Do follows.
+type RedirectPolicy struct {
+	// MaxRedirects defaults to DefaultMaxRedirects, a negative value follows
+	// no redirect and returns the redirect response itself.
+	MaxRedirects int
+	// AllowedSchemes defaults to http and https.
+	AllowedSchemes []string
+	// AllowedHosts is matched case-insensitively against the target host,
+	// a leading "*." allows every subdomain. Empty allows every host.
+	AllowedHosts []string
+	// AllowDowngrade follows a redirect from https to http.
+	AllowDowngrade bool
+	// ForwardCredentials keeps the Authorization header when the redirect
+	// leaves the original host, otherwise it is removed.
+	ForwardCredentials bool
+	// NoBodyReplay returns a 307 or 308 response instead of sending the
+	// request body again to the new location.
+	NoBodyReplay bool
+}
+
+// Redirect is one hop of the redirect chain of the last Do.
+type Redirect struct {
+	StatusCode int
+	Method     string
+	From       string
+	To         string
+}
+
+func (redirect Redirect) String() string {
+	return fmt.Sprintf("%d %s %s -> %s", redirect.StatusCode, redirect.Method, redirect.From, redirect.To)
+}
+
+func (base *Requester) SetRedirectPolicy(policy RedirectPolicy) *Requester {
+	policy.AllowedSchemes = append([]string(nil), policy.AllowedSchemes...)
+	policy.AllowedHosts = append([]string(nil), policy.AllowedHosts...)
+	base.redirectPolicy = &policy
+	return base
+}
+
+// Redirects returns the redirects followed or refused by the last Do.
+func (base *Requester) Redirects() []Redirect {
+	return base.redirects
+}
+
+// withRedirectPolicy returns a copy of client that records the redirect chain
+// and applies the redirect policy, a client of SetClient is never modified.
+func (base *Requester) withRedirectPolicy(client *http.Client) *http.Client {
+	checked := *client
+	original := client.CheckRedirect
+	checked.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		previous := via[len(via)-1]
+		redirect := Redirect{Method: req.Method, From: previous.URL.String(), To: req.URL.String()}
+		if req.Response != nil {
+			redirect.StatusCode = req.Response.StatusCode
+		}
+		base.redirects = append(base.redirects, redirect)
+
+		if base.redirectPolicy != nil {
+			return base.redirectPolicy.check(req, via)
+		}
+		if original != nil {
+			if err := original(req, via); err != nil {
+				return err
+			}
+		} else if len(via) > DefaultMaxRedirects {
+			return fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirects, DefaultMaxRedirects)
+		}
+		forwardCredentials(req, via, false)
+		return nil
+	}
+	return &checked
+}
+
+func (policy *RedirectPolicy) check(req *http.Request, via []*http.Request) error {
+	if policy.MaxRedirects < 0 {
+		return http.ErrUseLastResponse
+	}
+	maxRedirects := policy.MaxRedirects
+	if maxRedirects == 0 {
+		maxRedirects = DefaultMaxRedirects
+	}
+	if len(via) > maxRedirects {
+		return fmt.Errorf("%w: stopped after %d redirects", ErrTooManyRedirects, maxRedirects)
+	}
+
+	previous := via[len(via)-1]
+	if !policy.schemeAllowed(req.URL.Scheme) {
+		return fmt.Errorf("%w: scheme %q of %s is not allowed", ErrRedirectRefused, req.URL.Scheme, req.URL)
+	}
+	if previous.URL.Scheme == "https" && req.URL.Scheme == "http" && !policy.AllowDowngrade {
+		return fmt.Errorf("%w: https to http downgrade to %s", ErrRedirectRefused, req.URL)
+	}
+	if !policy.hostAllowed(req.URL.Hostname()) {
+		return fmt.Errorf("%w: host %q is not allowed", ErrRedirectRefused, req.URL.Hostname())
+	}
+	if policy.NoBodyReplay && req.Response != nil && previous.GetBody != nil && previous.ContentLength != 0 {
+		switch req.Response.StatusCode {
+		case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			return http.ErrUseLastResponse
+		}
+	}
+
+	forwardCredentials(req, via, policy.ForwardCredentials)
+	return nil
+}
+
+// forwardCredentials trusts only the exact host and port of the first
+// request, net/http also keeps Authorization for subdomains and other ports.
+func forwardCredentials(req *http.Request, via []*http.Request, forward bool) {
+	first := via[0]
+	if strings.EqualFold(req.URL.Host, first.URL.Host) {
+		return
+	}
+	if forward {
+		if auth := first.Header.Get(Auth); auth != "" {
+			req.Header.Set(Auth, auth)
+		}
+		return
+	}
+	req.Header.Del(Auth)
+}
+
+func (policy *RedirectPolicy) schemeAllowed(scheme string) bool {
+	if len(policy.AllowedSchemes) == 0 {
+		return scheme == "http" || scheme == "https"
+	}
+	for _, allowed := range policy.AllowedSchemes {
+		if strings.EqualFold(allowed, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *RedirectPolicy) hostAllowed(host string) bool {
+	if len(policy.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, allowed := range policy.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) || host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func debugRedirects(redirects []string) string {
+	if len(redirects) == 0 {
+		return "-"
+	}
+	return strings.Join(redirects, "\n\t                  ")
+}
@@ -0,0 +1,155 @@
+package bunker
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "auth="+r.Header.Get(Auth))
+	}))
+	defer other.Close()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hops, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/chain/")); err == nil {
+			if hops > 0 {
+				http.Redirect(w, r, "/chain/"+strconv.Itoa(hops-1), http.StatusFound)
+			}
+			return
+		}
+		switch r.URL.Path {
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/hop":
+			http.Redirect(w, r, "/final", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, other.URL+"/landing", http.StatusFound)
+		case "/ftp":
+			http.Redirect(w, r, "ftp://example.com/file", http.StatusFound)
+		case "/temporary":
+			http.Redirect(w, r, "/echo", http.StatusTemporaryRedirect)
+		case "/echo":
+			body, _ := io.ReadAll(r.Body)
+			_, _ = io.WriteString(w, r.Method+" "+string(body))
+		default:
+			_, _ = io.WriteString(w, "auth="+r.Header.Get(Auth))
+		}
+	}))
+	defer server.Close()
+
+	body := func(req *Requester) string {
+		if req.Response == nil {
+			return ""
+		}
+		data, _ := io.ReadAll(req.Response.Body)
+		return string(data)
+	}
+
+	t.Run("testChainRecorded", func(t *testing.T) {
+		req := New(server.URL).AddPath("hop").Get().Do()
+		redirects := req.Redirects()
+		if len(redirects) != 1 || redirects[0].StatusCode != http.StatusFound || !strings.HasSuffix(redirects[0].To, "/final") {
+			t.Errorf("invalid redirect chain %+v", redirects)
+		}
+		if !strings.Contains(req.debug(), "302 GET "+server.URL+"/hop -> "+server.URL+"/final") {
+			t.Errorf("debug output must contain the redirect chain")
+		}
+	})
+
+	t.Run("testMaxRedirects", func(t *testing.T) {
+		req := New(server.URL).AddPath("loop").SetRedirectPolicy(RedirectPolicy{MaxRedirects: 3}).Get().Do()
+		if !errors.Is(req.Err(), ErrTooManyRedirects) || len(req.Redirects()) != 4 {
+			t.Errorf("invalid max redirects %v %d", req.Errors, len(req.Redirects()))
+		}
+
+		req = New(server.URL).AddPath("hop").SetRedirectPolicy(RedirectPolicy{MaxRedirects: -1}).Get().Do()
+		if req.HaveError() || req.Response.StatusCode != http.StatusFound {
+			t.Errorf("invalid status\n\tExpected : %v\n\tActual : %v", http.StatusFound, req.Response.StatusCode)
+		}
+	})
+
+	t.Run("testLimitIsInclusive", func(t *testing.T) {
+		for _, policy := range []*RedirectPolicy{nil, {}, {MaxRedirects: 3}} {
+			limit := DefaultMaxRedirects
+			if policy != nil && policy.MaxRedirects > 0 {
+				limit = policy.MaxRedirects
+			}
+			req := New(server.URL).AddPath("chain/" + strconv.Itoa(limit))
+			if policy != nil {
+				req.SetRedirectPolicy(*policy)
+			}
+			if req.Get().Do(); req.HaveError() || len(req.Redirects()) != limit {
+				t.Errorf("%d redirects must be followed, got %v", limit, req.Errors)
+			}
+
+			req = New(server.URL).AddPath("chain/" + strconv.Itoa(limit+1))
+			if policy != nil {
+				req.SetRedirectPolicy(*policy)
+			}
+			if req.Get().Do(); !errors.Is(req.Err(), ErrTooManyRedirects) {
+				t.Errorf("%d redirects must be refused, got %v", limit+1, req.Errors)
+			}
+		}
+	})
+
+	t.Run("testCredentialsStripped", func(t *testing.T) {
+		req := New(server.URL).AddPath("away").SetToken("secret").Get().Do()
+		if actual := body(req); actual != "auth=" {
+			t.Errorf("invalid forwarded credentials\n\tExpected : %v\n\tActual : %v", "auth=", actual)
+		}
+
+		req = New(server.URL).AddPath("away").SetToken("secret").SetRedirectPolicy(RedirectPolicy{ForwardCredentials: true}).Get().Do()
+		if actual := body(req); actual != "auth="+Bearer+"secret" {
+			t.Errorf("invalid forwarded credentials\n\tExpected : %v\n\tActual : %v", "auth="+Bearer+"secret", actual)
+		}
+
+		req = New(server.URL).AddPath("hop").SetToken("secret").SetRedirectPolicy(RedirectPolicy{}).Get().Do()
+		if actual := body(req); actual != "auth="+Bearer+"secret" {
+			t.Errorf("same host must keep credentials\n\tActual : %v", actual)
+		}
+	})
+
+	t.Run("testRefused", func(t *testing.T) {
+		req := New(server.URL).AddPath("ftp").SetRedirectPolicy(RedirectPolicy{}).Get().Do()
+		if !errors.Is(req.Err(), ErrRedirectRefused) {
+			t.Errorf("invalid scheme error %v", req.Errors)
+		}
+
+		req = New(server.URL).AddPath("away").SetRedirectPolicy(RedirectPolicy{AllowedHosts: []string{"*.example.com"}}).Get().Do()
+		if !errors.Is(req.Err(), ErrRedirectRefused) {
+			t.Errorf("invalid host error %v", req.Errors)
+		}
+	})
+
+	t.Run("testBodyReplay", func(t *testing.T) {
+		req := New(server.URL).AddPath("temporary").SetPayload("data").Post().Do()
+		if actual := body(req); actual != "POST data" {
+			t.Errorf("invalid replay\n\tExpected : %v\n\tActual : %v", "POST data", actual)
+		}
+
+		req = New(server.URL).AddPath("temporary").SetPayload("data").SetRedirectPolicy(RedirectPolicy{NoBodyReplay: true}).Post().Do()
+		if req.HaveError() || req.Response.StatusCode != http.StatusTemporaryRedirect {
+			t.Errorf("invalid status without replay %v", req.Errors)
+		}
+	})
+
+	t.Run("testDowngrade", func(t *testing.T) {
+		policy := RedirectPolicy{}
+		via := []*http.Request{httptest.NewRequest(GET, "https://example.com/", nil)}
+		next := httptest.NewRequest(GET, "http://example.com/", nil)
+		if err := policy.check(next, via); !errors.Is(err, ErrRedirectRefused) {
+			t.Errorf("invalid downgrade error %v", err)
+		}
+		policy.AllowDowngrade = true
+		if err := policy.check(next, via); err != nil {
+			t.Errorf("invalid downgrade error %v", err)
+		}
+	})
+}
@@ -0,0 +1,633 @@
+package bunker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yudhiana/bunker"
+	apperr "github.com/yudhiana/bunker/errors"
+)
+
+// Schema is a compiled JSON Schema supporting the draft 2020-12 keywords
+// type, enum, const, properties, required, additionalProperties,
+// patternProperties, minProperties, maxProperties, dependentRequired,
+// dependentSchemas, items, prefixItems, contains, minItems, maxItems,
+// uniqueItems, minLength, maxLength, pattern, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, multipleOf, allOf, anyOf, oneOf, not,
+// if/then/else and local $ref. format is an annotation only and patterns use
+// the RE2 syntax.
+type Schema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+func CompileSchema(data []byte) (*Schema, error) {
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	schema := &Schema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	if err := schema.compile(root, "", make(map[string]bool)); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+func MustCompileSchema(data []byte) *Schema {
+	schema, err := CompileSchema(data)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// compile checks the schema once so validation cannot fail on the schema
+// itself, the targets of $ref are compiled wherever they are in the document.
+// refs holds the references already followed.
+func (schema *Schema) compile(node interface{}, location string, refs map[string]bool) error {
+	switch node := node.(type) {
+	case bool:
+		return nil
+	case map[string]interface{}:
+		for _, keyword := range sortedKeys(node) {
+			value, at := node[keyword], location+"/"+escapePointer(keyword)
+			switch keyword {
+			case "pattern":
+				if err := schema.compilePattern(value, at); err != nil {
+					return err
+				}
+			case "patternProperties":
+				properties, _ := value.(map[string]interface{})
+				for _, pattern := range sortedKeys(properties) {
+					if err := schema.compilePattern(pattern, at); err != nil {
+						return err
+					}
+				}
+			case "$ref":
+				ref, _ := value.(string)
+				target, err := schema.resolve(ref)
+				if err != nil {
+					return fmt.Errorf("invalid schema at %s: %w", at, err)
+				}
+				if !refs[ref] {
+					refs[ref] = true
+					if err := schema.compile(target, strings.TrimPrefix(ref, "#"), refs); err != nil {
+						return err
+					}
+				}
+			}
+			switch keyword {
+			case "properties", "patternProperties", "$defs", "definitions", "dependentSchemas":
+				properties, _ := value.(map[string]interface{})
+				for _, name := range sortedKeys(properties) {
+					if err := schema.compile(properties[name], at+"/"+escapePointer(name), refs); err != nil {
+						return err
+					}
+				}
+			case "prefixItems", "allOf", "anyOf", "oneOf":
+				items, _ := value.([]interface{})
+				for i, item := range items {
+					if err := schema.compile(item, at+"/"+strconv.Itoa(i), refs); err != nil {
+						return err
+					}
+				}
+			case "items", "contains", "additionalProperties", "not", "if", "then", "else", "propertyNames":
+				if err := schema.compile(value, at, refs); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid schema at %q: expected an object or a boolean", location)
+}
+
+func (schema *Schema) compilePattern(value interface{}, location string) error {
+	pattern, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("invalid schema at %s: pattern must be a string", location)
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid schema at %s: %w", location, err)
+	}
+	schema.patterns[pattern] = compiled
+	return nil
+}
+
+// resolve follows a $ref to a JSON pointer inside the same document.
+func (schema *Schema) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("only local references are supported, got %q", ref)
+	}
+	node := schema.root
+	pointer := strings.TrimPrefix(ref, "#")
+	if pointer == "" {
+		return node, nil
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch current := node.(type) {
+		case map[string]interface{}:
+			next, found := current[token]
+			if !found {
+				return nil, fmt.Errorf("unresolvable reference %q", ref)
+			}
+			node = next
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(current) {
+				return nil, fmt.Errorf("unresolvable reference %q", ref)
+			}
+			node = current[i]
+		default:
+			return nil, fmt.Errorf("unresolvable reference %q", ref)
+		}
+	}
+	return node, nil
+}
+
+// SchemaViolation is one failed assertion, both locations are JSON pointers.
+type SchemaViolation struct {
+	InstanceLocation string `json:"instance_location"`
+	KeywordLocation  string `json:"keyword_location"`
+	Message          string `json:"message"`
+}
+
+func (violation SchemaViolation) String() string {
+	location := violation.InstanceLocation
+	if location == "" {
+		location = "/"
+	}
+	return location + ": " + violation.Message
+}
+
+// ValidationError reports a payload or response that does not match its schema.
+type ValidationError struct {
+	// Target is "payload" or "response".
+	Target     string
+	Violations []SchemaViolation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.String()
+	}
+	return fmt.Sprintf("%s does not match schema: %s", e.Target, strings.Join(messages, "; "))
+}
+
+func (e *ValidationError) ApplicationError() *apperr.ApplicationError {
+	// New returns a shared value, it must not be modified
+	appErr := *apperr.New(apperr.StatusUnprocessableEntity)
+	return appErr.SetError(e)
+}
+
+// Validate checks a JSON document, the result is nil when it matches.
+func (schema *Schema) Validate(document []byte) []SchemaViolation {
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	var instance interface{}
+	if err := decoder.Decode(&instance); err != nil {
+		return []SchemaViolation{{Message: "invalid JSON: " + err.Error()}}
+	}
+	validator := &schemaValidator{schema: schema, visiting: make(map[string]bool)}
+	validator.validate(schema.root, instance, "", "")
+	return validator.violations
+}
+
+// SetPayloadSchema validates the JSON payload before it is sent.
+func (base *Requester) SetPayloadSchema(schema *Schema) *Requester {
+	base.payloadSchema = schema
+	return base
+}
+
+// SetResponseSchema validates 2xx JSON response bodies after Do.
+func (base *Requester) SetResponseSchema(schema *Schema) *Requester {
+	base.responseSchema = schema
+	return base
+}
+
+// SetSchemaLogOnly logs violations instead of adding them to Errors.
+func (base *Requester) SetSchemaLogOnly(logOnly bool) *Requester {
+	base.schemaLogOnly = logOnly
+	return base
+}
+
+// validatePayload reports whether the request may be sent, payloads of
+// another type than JSON are not validated.
+func (base *Requester) validatePayload() bool {
+	if base.payloadSchema == nil || base.payload == nil {
+		return true
+	}
+	contentType := headerValue(base.Header, "Content-Type")
+	if bunker.IsEmptyString(contentType) {
+		contentType = base.payloadContentType
+	}
+	if !isJSONType(contentType) {
+		return true
+	}
+	return base.schemaResult("payload", base.payloadSchema.Validate(base.payload))
+}
+
+func (base *Requester) validateResponse() {
+	if base.responseSchema == nil || base.Response == nil || base.Response.Body == nil ||
+		base.Response.StatusCode < http.StatusOK || base.Response.StatusCode >= http.StatusMultipleChoices ||
+		base.Response.StatusCode == http.StatusNoContent || !isJSONType(base.Response.Header.Get("Content-Type")) {
+		return
+	}
+	body := base.readAll(base.Response.Body)
+	base.Response.Body.Close()
+	base.Response.Body = nopCloser(body)
+	if body == nil {
+		return
+	}
+	base.schemaResult("response", base.responseSchema.Validate(body))
+}
+
+func (base *Requester) schemaResult(target string, violations []SchemaViolation) bool {
+	if len(violations) == 0 {
+		return true
+	}
+	err := &ValidationError{Target: target, Violations: violations}
+	if base.schemaLogOnly {
+		bunker.LogWarn(err.Error())
+		return true
+	}
+	base.Errors = append(base.Errors, err)
+	return false
+}
+
+type schemaValidator struct {
+	schema     *Schema
+	violations []SchemaViolation
+	// visiting holds the $ref and instance location pairs being validated,
+	// meeting one again means the schema loops without consuming the instance
+	visiting map[string]bool
+}
+
+func (v *schemaValidator) fail(instance, keyword, format string, args ...interface{}) {
+	v.violations = append(v.violations, SchemaViolation{
+		InstanceLocation: instance,
+		KeywordLocation:  keyword,
+		Message:          fmt.Sprintf(format, args...),
+	})
+}
+
+// valid runs a subschema on its own, for the applicators that only need to
+// know whether it matched.
+func (v *schemaValidator) valid(node, instance interface{}, instanceAt, keywordAt string) bool {
+	sub := &schemaValidator{schema: v.schema, visiting: v.visiting}
+	sub.validate(node, instance, instanceAt, keywordAt)
+	return len(sub.violations) == 0
+}
+
+func (v *schemaValidator) validate(node, instance interface{}, instanceAt, keywordAt string) {
+	switch node := node.(type) {
+	case bool:
+		if !node {
+			v.fail(instanceAt, keywordAt, "no value is allowed")
+		}
+		return
+	case map[string]interface{}:
+		v.validateObjectSchema(node, instance, instanceAt, keywordAt)
+	}
+}
+
+func (v *schemaValidator) validateObjectSchema(node map[string]interface{}, instance interface{}, instanceAt, keywordAt string) {
+	if ref, ok := node["$ref"].(string); ok {
+		key := ref + " " + instanceAt
+		if v.visiting[key] {
+			v.fail(instanceAt, keywordAt+"/$ref", "circular $ref %s", ref)
+			return
+		}
+		// resolvable refs were checked by compile
+		target, _ := v.schema.resolve(ref)
+		v.visiting[key] = true
+		v.validate(target, instance, instanceAt, keywordAt+"/$ref")
+		delete(v.visiting, key)
+	}
+
+	if types, found := node["type"]; found && !matchesType(types, instance) {
+		v.fail(instanceAt, keywordAt+"/type", "expected %s, got %s", typeNames(types), jsonType(instance))
+		return
+	}
+	if values, ok := node["enum"].([]interface{}); ok {
+		matched := false
+		for _, value := range values {
+			matched = matched || jsonEqual(value, instance)
+		}
+		if !matched {
+			v.fail(instanceAt, keywordAt+"/enum", "value is not one of the allowed values")
+		}
+	}
+	if value, found := node["const"]; found && !jsonEqual(value, instance) {
+		v.fail(instanceAt, keywordAt+"/const", "value must be %s", compactJSON(value))
+	}
+
+	switch instance := instance.(type) {
+	case map[string]interface{}:
+		v.validateObject(node, instance, instanceAt, keywordAt)
+	case []interface{}:
+		v.validateArray(node, instance, instanceAt, keywordAt)
+	case string:
+		v.validateString(node, instance, instanceAt, keywordAt)
+	case json.Number:
+		v.validateNumber(node, instance, instanceAt, keywordAt)
+	}
+
+	if schemas, ok := node["allOf"].([]interface{}); ok {
+		for i, sub := range schemas {
+			v.validate(sub, instance, instanceAt, keywordAt+"/allOf/"+strconv.Itoa(i))
+		}
+	}
+	if schemas, ok := node["anyOf"].([]interface{}); ok {
+		matched := false
+		for i, sub := range schemas {
+			matched = matched || v.valid(sub, instance, instanceAt, keywordAt+"/anyOf/"+strconv.Itoa(i))
+		}
+		if !matched {
+			v.fail(instanceAt, keywordAt+"/anyOf", "value matches none of the schemas")
+		}
+	}
+	if schemas, ok := node["oneOf"].([]interface{}); ok {
+		matched := 0
+		for i, sub := range schemas {
+			if v.valid(sub, instance, instanceAt, keywordAt+"/oneOf/"+strconv.Itoa(i)) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			v.fail(instanceAt, keywordAt+"/oneOf", "value matches %d schemas instead of exactly one", matched)
+		}
+	}
+	if sub, found := node["not"]; found && v.valid(sub, instance, instanceAt, keywordAt+"/not") {
+		v.fail(instanceAt, keywordAt+"/not", "value must not match the schema")
+	}
+	if condition, found := node["if"]; found {
+		if v.valid(condition, instance, instanceAt, keywordAt+"/if") {
+			if then, found := node["then"]; found {
+				v.validate(then, instance, instanceAt, keywordAt+"/then")
+			}
+		} else if otherwise, found := node["else"]; found {
+			v.validate(otherwise, instance, instanceAt, keywordAt+"/else")
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(node map[string]interface{}, instance map[string]interface{}, instanceAt, keywordAt string) {
+	if required, ok := node["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, found := instance[name]; !found {
+					v.fail(instanceAt, keywordAt+"/required", "missing property %q", name)
+				}
+			}
+		}
+	}
+	if dependent, ok := node["dependentRequired"].(map[string]interface{}); ok {
+		for _, name := range sortedKeys(dependent) {
+			if _, found := instance[name]; !found {
+				continue
+			}
+			required, _ := dependent[name].([]interface{})
+			for _, other := range required {
+				if other, ok := other.(string); ok {
+					if _, found := instance[other]; !found {
+						v.fail(instanceAt, keywordAt+"/dependentRequired/"+escapePointer(name), "property %q requires %q", name, other)
+					}
+				}
+			}
+		}
+	}
+	if dependent, ok := node["dependentSchemas"].(map[string]interface{}); ok {
+		for _, name := range sortedKeys(dependent) {
+			if _, found := instance[name]; found {
+				v.validate(dependent[name], instance, instanceAt, keywordAt+"/dependentSchemas/"+escapePointer(name))
+			}
+		}
+	}
+	if limit, ok := schemaInt(node["minProperties"]); ok && len(instance) < limit {
+		v.fail(instanceAt, keywordAt+"/minProperties", "expected at least %d properties, got %d", limit, len(instance))
+	}
+	if limit, ok := schemaInt(node["maxProperties"]); ok && len(instance) > limit {
+		v.fail(instanceAt, keywordAt+"/maxProperties", "expected at most %d properties, got %d", limit, len(instance))
+	}
+
+	properties, _ := node["properties"].(map[string]interface{})
+	patterns, _ := node["patternProperties"].(map[string]interface{})
+	names := sortedKeys(instance)
+	for _, name := range names {
+		at := instanceAt + "/" + escapePointer(name)
+		evaluated := false
+		if sub, found := properties[name]; found {
+			evaluated = true
+			v.validate(sub, instance[name], at, keywordAt+"/properties/"+escapePointer(name))
+		}
+		for _, pattern := range sortedKeys(patterns) {
+			compiled := v.schema.patterns[pattern]
+			if compiled == nil {
+				v.fail(at, keywordAt+"/patternProperties/"+escapePointer(pattern), "pattern %q was not compiled", pattern)
+				continue
+			}
+			if compiled.MatchString(name) {
+				evaluated = true
+				v.validate(patterns[pattern], instance[name], at, keywordAt+"/patternProperties/"+escapePointer(pattern))
+			}
+		}
+		if additional, found := node["additionalProperties"]; found && !evaluated {
+			if additional == false {
+				v.fail(at, keywordAt+"/additionalProperties", "property %q is not allowed", name)
+			} else {
+				v.validate(additional, instance[name], at, keywordAt+"/additionalProperties")
+			}
+		}
+		if sub, found := node["propertyNames"]; found {
+			v.validate(sub, name, at, keywordAt+"/propertyNames")
+		}
+	}
+}
+
+func (v *schemaValidator) validateArray(node map[string]interface{}, instance []interface{}, instanceAt, keywordAt string) {
+	if limit, ok := schemaInt(node["minItems"]); ok && len(instance) < limit {
+		v.fail(instanceAt, keywordAt+"/minItems", "expected at least %d items, got %d", limit, len(instance))
+	}
+	if limit, ok := schemaInt(node["maxItems"]); ok && len(instance) > limit {
+		v.fail(instanceAt, keywordAt+"/maxItems", "expected at most %d items, got %d", limit, len(instance))
+	}
+	if unique, _ := node["uniqueItems"].(bool); unique {
+		for i := range instance {
+			for j := 0; j < i; j++ {
+				if jsonEqual(instance[i], instance[j]) {
+					v.fail(instanceAt, keywordAt+"/uniqueItems", "items %d and %d are equal", j, i)
+				}
+			}
+		}
+	}
+
+	prefix, _ := node["prefixItems"].([]interface{})
+	for i, item := range instance {
+		at := instanceAt + "/" + strconv.Itoa(i)
+		if i < len(prefix) {
+			v.validate(prefix[i], item, at, keywordAt+"/prefixItems/"+strconv.Itoa(i))
+		} else if items, found := node["items"]; found {
+			v.validate(items, item, at, keywordAt+"/items")
+		}
+	}
+	if contains, found := node["contains"]; found {
+		matched := 0
+		for i, item := range instance {
+			if v.valid(contains, item, instanceAt+"/"+strconv.Itoa(i), keywordAt+"/contains") {
+				matched++
+			}
+		}
+		minContains, ok := schemaInt(node["minContains"])
+		if !ok {
+			minContains = 1
+		}
+		if matched < minContains {
+			v.fail(instanceAt, keywordAt+"/contains", "expected at least %d matching items, got %d", minContains, matched)
+		}
+		if maxContains, ok := schemaInt(node["maxContains"]); ok && matched > maxContains {
+			v.fail(instanceAt, keywordAt+"/maxContains", "expected at most %d matching items, got %d", maxContains, matched)
+		}
+	}
+}
+
+func (v *schemaValidator) validateString(node map[string]interface{}, instance string, instanceAt, keywordAt string) {
+	length := utf8.RuneCountInString(instance)
+	if limit, ok := schemaInt(node["minLength"]); ok && length < limit {
+		v.fail(instanceAt, keywordAt+"/minLength", "expected at least %d characters, got %d", limit, length)
+	}
+	if limit, ok := schemaInt(node["maxLength"]); ok && length > limit {
+		v.fail(instanceAt, keywordAt+"/maxLength", "expected at most %d characters, got %d", limit, length)
+	}
+	if pattern, ok := node["pattern"].(string); ok {
+		if compiled := v.schema.patterns[pattern]; compiled == nil {
+			v.fail(instanceAt, keywordAt+"/pattern", "pattern %q was not compiled", pattern)
+		} else if !compiled.MatchString(instance) {
+			v.fail(instanceAt, keywordAt+"/pattern", "value does not match %q", pattern)
+		}
+	}
+}
+
+func (v *schemaValidator) validateNumber(node map[string]interface{}, instance json.Number, instanceAt, keywordAt string) {
+	value, _ := instance.Float64()
+	if limit, ok := node["minimum"].(float64); ok && value < limit {
+		v.fail(instanceAt, keywordAt+"/minimum", "expected at least %v, got %v", limit, instance)
+	}
+	if limit, ok := node["maximum"].(float64); ok && value > limit {
+		v.fail(instanceAt, keywordAt+"/maximum", "expected at most %v, got %v", limit, instance)
+	}
+	if limit, ok := node["exclusiveMinimum"].(float64); ok && value <= limit {
+		v.fail(instanceAt, keywordAt+"/exclusiveMinimum", "expected more than %v, got %v", limit, instance)
+	}
+	if limit, ok := node["exclusiveMaximum"].(float64); ok && value >= limit {
+		v.fail(instanceAt, keywordAt+"/exclusiveMaximum", "expected less than %v, got %v", limit, instance)
+	}
+	if divisor, ok := node["multipleOf"].(float64); ok && divisor > 0 {
+		quotient := value / divisor
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			v.fail(instanceAt, keywordAt+"/multipleOf", "expected a multiple of %v, got %v", divisor, instance)
+		}
+	}
+}
+
+func matchesType(types, instance interface{}) bool {
+	switch types := types.(type) {
+	case string:
+		return matchesTypeName(types, instance)
+	case []interface{}:
+		for _, name := range types {
+			if name, ok := name.(string); ok && matchesTypeName(name, instance) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesTypeName(name string, instance interface{}) bool {
+	actual := jsonType(instance)
+	return actual == name || name == "number" && actual == "integer"
+}
+
+func typeNames(types interface{}) string {
+	if list, ok := types.([]interface{}); ok {
+		names := make([]string, len(list))
+		for i, name := range list {
+			names[i] = fmt.Sprint(name)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(types)
+}
+
+func jsonType(instance interface{}) string {
+	switch instance := instance.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if value, err := instance.Float64(); err == nil && value == math.Trunc(value) {
+			return "integer"
+		}
+	}
+	return "number"
+}
+
+// jsonEqual compares a schema value, decoded with float64 numbers, with an
+// instance decoded with json.Number.
+func jsonEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(normalizeJSON(a), normalizeJSON(b))
+}
+
+func normalizeJSON(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		number, _ := value.Float64()
+		return number
+	case []interface{}:
+		normalized := make([]interface{}, len(value))
+		for i, item := range value {
+			normalized[i] = normalizeJSON(item)
+		}
+		return normalized
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			normalized[key] = normalizeJSON(item)
+		}
+		return normalized
+	}
+	return value
+}
+
+func schemaInt(value interface{}) (int, bool) {
+	number, ok := value.(float64)
+	return int(number), ok
+}
+
+func compactJSON(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
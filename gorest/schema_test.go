@@ -0,0 +1,191 @@
+package bunker
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apperr "github.com/yudhiana/bunker/errors"
+)
+
+var orderSchema = MustCompileSchema([]byte(`{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["id", "items"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "string", "pattern": "^ord-[0-9]+$"},
+		"status": {"enum": ["open", "paid"]},
+		"total": {"type": "number", "minimum": 0, "multipleOf": 0.01},
+		"items": {"type": "array", "minItems": 1, "items": {"$ref": "#/$defs/item"}},
+		"note": {"type": ["string", "null"], "maxLength": 5}
+	},
+	"$defs": {
+		"item": {
+			"type": "object",
+			"required": ["sku"],
+			"properties": {"sku": {"type": "string"}, "qty": {"type": "integer", "exclusiveMinimum": 0}}
+		}
+	}
+}`))
+
+func TestSchemaValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		document string
+		expected []SchemaViolation
+	}{
+		{"testValid", `{"id":"ord-1","status":"paid","total":10.25,"items":[{"sku":"a","qty":2}],"note":null}`, nil},
+		{"testRequired", `{"id":"ord-1"}`, []SchemaViolation{{"", "/required", `missing property "items"`}}},
+		{"testNested", `{"id":"x","items":[{"qty":1.5}],"extra":1}`, []SchemaViolation{
+			{"/extra", "/additionalProperties", `property "extra" is not allowed`},
+			{"/id", "/properties/id/pattern", `value does not match "^ord-[0-9]+$"`},
+			{"/items/0", "/properties/items/items/$ref/required", `missing property "sku"`},
+			{"/items/0/qty", "/properties/items/items/$ref/properties/qty/type", "expected integer, got number"},
+		}},
+		{"testScalars", `{"id":"ord-1","items":[{"sku":"a"}],"status":"lost","total":1.001,"note":"too long"}`, []SchemaViolation{
+			{"/note", "/properties/note/maxLength", "expected at most 5 characters, got 8"},
+			{"/status", "/properties/status/enum", "value is not one of the allowed values"},
+			{"/total", "/properties/total/multipleOf", "expected a multiple of 0.01, got 1.001"},
+		}},
+		{"testInvalidJSON", `{`, []SchemaViolation{{"", "", "invalid JSON: unexpected EOF"}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual := orderSchema.Validate([]byte(c.document))
+			if len(actual) != len(c.expected) {
+				t.Fatalf("invalid violations\n\tExpected : %v\n\tActual : %v", c.expected, actual)
+			}
+			for i := range actual {
+				if actual[i] != c.expected[i] {
+					t.Errorf("invalid violation\n\tExpected : %+v\n\tActual : %+v", c.expected[i], actual[i])
+				}
+			}
+		})
+	}
+
+	t.Run("testCombinators", func(t *testing.T) {
+		schema := MustCompileSchema([]byte(`{
+			"oneOf": [{"type": "integer"}, {"type": "number", "maximum": 10}],
+			"not": {"const": 3}
+		}`))
+		expected := map[string]int{`20`: 0, `2`: 1, `3`: 2, `2.5`: 0, `"a"`: 1}
+		for document, violations := range expected {
+			if actual := schema.Validate([]byte(document)); len(actual) != violations {
+				t.Errorf("invalid violations for %s\n\tExpected : %v\n\tActual : %v", document, violations, actual)
+			}
+		}
+	})
+
+	t.Run("testCircularRef", func(t *testing.T) {
+		for _, schema := range []string{`{"$ref": "#"}`, `{"allOf": [{"$ref": "#"}]}`} {
+			if actual := MustCompileSchema([]byte(schema)).Validate([]byte(`{}`)); len(actual) != 1 {
+				t.Errorf("circular schema %s must fail once, got %v", schema, actual)
+			}
+		}
+		tree := MustCompileSchema([]byte(`{"type": "object", "properties": {"child": {"$ref": "#"}}}`))
+		if actual := tree.Validate([]byte(`{"child": {"child": {}}}`)); len(actual) != 0 {
+			t.Errorf("recursive schema must follow the instance %v", actual)
+		}
+	})
+
+	t.Run("testRefTargetsCompiled", func(t *testing.T) {
+		schema, err := CompileSchema([]byte(`{
+			"properties": {"code": {"$ref": "#/definitions/code"}, "tags": {"$ref": "#/definitions/tags"}},
+			"definitions": {
+				"code": {"type": "string", "pattern": "^[A-Z]{3}$"},
+				"tags": {"patternProperties": {"^x-": {"type": "string"}}}
+			}
+		}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := schema.Validate([]byte(`{"code": "ABC", "tags": {"x-a": "b"}}`)); len(actual) != 0 {
+			t.Errorf("invalid violations %v", actual)
+		}
+		if actual := schema.Validate([]byte(`{"code": "abc", "tags": {"x-a": 1}}`)); len(actual) != 2 {
+			t.Errorf("invalid violations\n\tExpected : %v\n\tActual : %v", 2, actual)
+		}
+		if _, err := CompileSchema([]byte(`{"$ref": "#/other", "other": {"pattern": "("}}`)); err == nil {
+			t.Errorf("invalid patterns of a $ref target must be reported")
+		}
+	})
+
+	t.Run("testDependentSchemas", func(t *testing.T) {
+		schema := MustCompileSchema([]byte(`{"dependentSchemas": {"card": {"required": ["cvv"]}}}`))
+		if actual := schema.Validate([]byte(`{"card": "4111"}`)); len(actual) != 1 || actual[0].KeywordLocation != "/dependentSchemas/card/required" {
+			t.Errorf("invalid violations %v", actual)
+		}
+		if actual := schema.Validate([]byte(`{"name": "x"}`)); len(actual) != 0 {
+			t.Errorf("invalid violations %v", actual)
+		}
+	})
+
+	t.Run("testInvalidSchema", func(t *testing.T) {
+		for _, schema := range []string{`{"pattern": "("}`, `{"$ref": "#/$defs/missing"}`, `{"items": 1}`, `[`} {
+			if _, err := CompileSchema([]byte(schema)); err == nil {
+				t.Errorf("schema %s must not compile", schema)
+			}
+		}
+	})
+}
+
+func TestSchemaRequester(t *testing.T) {
+	var received int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		if r.URL.Path != "/xml" {
+			w.Header().Set("Content-Type", Json)
+		}
+		_, _ = io.WriteString(w, `{"id":"ord-1","items":[]}`)
+	}))
+	defer server.Close()
+
+	t.Run("testPayload", func(t *testing.T) {
+		received = 0
+		req := New(server.URL).SetPayloadSchema(orderSchema).SetPayload(map[string]interface{}{"id": "ord-1"}).Post().Do()
+		var validationErr *ValidationError
+		if !errors.As(req.Err(), &validationErr) || validationErr.Target != "payload" || received != 0 {
+			t.Fatalf("invalid payload validation %v, %d requests", req.Errors, received)
+		}
+		if appErr := validationErr.ApplicationError(); appErr.Code != apperr.StatusUnprocessableEntity || appErr.Error != validationErr {
+			t.Errorf("invalid application error %+v", appErr)
+		}
+	})
+
+	t.Run("testResponse", func(t *testing.T) {
+		req := New(server.URL).SetResponseSchema(orderSchema).Get().Do()
+		var validationErr *ValidationError
+		if !errors.As(req.Err(), &validationErr) || validationErr.Target != "response" {
+			t.Fatalf("invalid response validation %v", req.Errors)
+		}
+		if validationErr.Violations[0].InstanceLocation != "/items" {
+			t.Errorf("invalid instance location\n\tExpected : %v\n\tActual : %v", "/items", validationErr.Violations[0].InstanceLocation)
+		}
+		if body, _ := io.ReadAll(req.Response.Body); len(body) == 0 {
+			t.Error("response body must stay readable")
+		}
+	})
+
+	t.Run("testOtherContentTypes", func(t *testing.T) {
+		req := New(server.URL).SetContentType(Form).SetPayloadSchema(orderSchema).SetPayload(map[string]string{"id": "ord-1"}).Post().Do()
+		if req.HaveError() {
+			t.Errorf("form payloads must not be validated %v", req.Errors)
+		}
+		req = New(server.URL).AddPath("xml").SetResponseSchema(orderSchema).Get().Do()
+		if req.HaveError() {
+			t.Errorf("responses of another type must not be validated %v", req.Errors)
+		}
+	})
+
+	t.Run("testLogOnly", func(t *testing.T) {
+		received = 0
+		req := New(server.URL).SetPayloadSchema(orderSchema).SetResponseSchema(orderSchema).SetSchemaLogOnly(true).
+			SetPayload(map[string]interface{}{"id": "ord-1"}).Post().Do()
+		if req.HaveError() || received != 1 {
+			t.Errorf("log only must not fail %v", req.Errors)
+		}
+	})
+}
@@ -0,0 +1,419 @@
+package bunker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Session is a cookie jar shared by every requester attached to it, so cookie
+// based logins survive across requests. It can be saved to disk and loaded
+// again as JSON or in the Netscape cookie file format.
+type Session struct {
+	mu       sync.Mutex
+	entries  map[string]*sessionCookie
+	sequence uint64
+	now      func() time.Time
+}
+
+type sessionCookie struct {
+	Name       string        `json:"name"`
+	Value      string        `json:"value"`
+	Domain     string        `json:"domain"`
+	Path       string        `json:"path"`
+	HostOnly   bool          `json:"host_only"`
+	Secure     bool          `json:"secure"`
+	HttpOnly   bool          `json:"http_only"`
+	SameSite   http.SameSite `json:"same_site,omitempty"`
+	Persistent bool          `json:"persistent"`
+	Expires    time.Time     `json:"expires,omitempty"`
+	Created    time.Time     `json:"created"`
+	sequence   uint64
+}
+
+func NewSession() *Session {
+	return &Session{entries: make(map[string]*sessionCookie), now: time.Now}
+}
+
+// New returns a requester that keeps its cookies in the session.
+func (session *Session) New(host string) *Requester {
+	return New(host).SetCookieJar(session)
+}
+
+// SetCookieJar replaces the jar that Do otherwise creates for every request,
+// and the jar of a client given to SetClient.
+func (base *Requester) SetCookieJar(jar http.CookieJar) *Requester {
+	base.cookieJar = jar
+	return base
+}
+
+func (cookie *sessionCookie) key() string {
+	return cookie.Domain + ";" + cookie.Path + ";" + cookie.Name
+}
+
+func (cookie *sessionCookie) expired(now time.Time) bool {
+	return cookie.Persistent && !cookie.Expires.After(now)
+}
+
+func (cookie *sessionCookie) httpCookie() *http.Cookie {
+	domain := cookie.Domain
+	if !cookie.HostOnly {
+		domain = "." + domain
+	}
+	return &http.Cookie{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Domain:   domain,
+		Path:     cookie.Path,
+		Expires:  cookie.Expires,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+		SameSite: cookie.SameSite,
+	}
+}
+
+// SetCookies implements http.CookieJar following the storage model of RFC 6265.
+func (session *Session) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	host := canonicalHost(u.Host)
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	now := session.now()
+	for _, cookie := range cookies {
+		entry := &sessionCookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+			SameSite: cookie.SameSite,
+			Created:  now,
+		}
+
+		domain := strings.TrimPrefix(strings.ToLower(cookie.Domain), ".")
+		if domain == "" || domain == host {
+			entry.Domain, entry.HostOnly = host, domain == ""
+		} else {
+			if net.ParseIP(host) != nil || !domainMatch(host, domain) || isPublicSuffix(domain) {
+				continue
+			}
+			entry.Domain = domain
+		}
+		if entry.Path == "" || entry.Path[0] != '/' {
+			entry.Path = defaultCookiePath(u.Path)
+		}
+
+		switch {
+		case cookie.MaxAge < 0:
+			entry.Persistent, entry.Expires = true, now
+		case cookie.MaxAge > 0:
+			entry.Persistent, entry.Expires = true, now.Add(time.Duration(cookie.MaxAge)*time.Second)
+		case !cookie.Expires.IsZero():
+			entry.Persistent, entry.Expires = true, cookie.Expires
+		}
+
+		session.sequence++
+		entry.sequence = session.sequence
+		if previous, found := session.entries[entry.key()]; found {
+			entry.Created, entry.sequence = previous.Created, previous.sequence
+		}
+		if entry.expired(now) {
+			delete(session.entries, entry.key())
+			continue
+		}
+		session.entries[entry.key()] = entry
+	}
+}
+
+// Cookies implements http.CookieJar.
+func (session *Session) Cookies(u *url.URL) []*http.Cookie {
+	host := canonicalHost(u.Host)
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	secure := u.Scheme == "https" || u.Scheme == "wss"
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	now := session.now()
+	var matched []*sessionCookie
+	for key, entry := range session.entries {
+		if entry.expired(now) {
+			delete(session.entries, key)
+			continue
+		}
+		if entry.HostOnly && host != entry.Domain || !entry.HostOnly && !domainMatch(host, entry.Domain) {
+			continue
+		}
+		if !pathMatch(path, entry.Path) || entry.Secure && !secure {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if len(matched[i].Path) != len(matched[j].Path) {
+			return len(matched[i].Path) > len(matched[j].Path)
+		}
+		if !matched[i].Created.Equal(matched[j].Created) {
+			return matched[i].Created.Before(matched[j].Created)
+		}
+		return matched[i].sequence < matched[j].sequence
+	})
+
+	cookies := make([]*http.Cookie, len(matched))
+	for i, entry := range matched {
+		cookies[i] = &http.Cookie{Name: entry.Name, Value: entry.Value}
+	}
+	return cookies
+}
+
+// DomainCookies lists the stored cookies of domain and its subdomains.
+func (session *Session) DomainCookies(domain string) []*http.Cookie {
+	domain = canonicalHost(domain)
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	var cookies []*http.Cookie
+	for _, entry := range session.sorted() {
+		if domainMatch(entry.Domain, domain) && !entry.expired(session.now()) {
+			cookies = append(cookies, entry.httpCookie())
+		}
+	}
+	return cookies
+}
+
+// ClearDomain removes the cookies of domain and its subdomains.
+func (session *Session) ClearDomain(domain string) {
+	domain = canonicalHost(domain)
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	for key, entry := range session.entries {
+		if domainMatch(entry.Domain, domain) {
+			delete(session.entries, key)
+		}
+	}
+}
+
+func (session *Session) Clear() {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.entries = make(map[string]*sessionCookie)
+}
+
+// sorted must be called with the lock held.
+func (session *Session) sorted() []*sessionCookie {
+	entries := make([]*sessionCookie, 0, len(session.entries))
+	for _, key := range sortedKeys(session.entries) {
+		entries = append(entries, session.entries[key])
+	}
+	return entries
+}
+
+// SaveJSON writes every cookie that has not expired, session cookies included.
+func (session *Session) SaveJSON(w io.Writer) error {
+	session.mu.Lock()
+	entries := session.liveEntries()
+	session.mu.Unlock()
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+func (session *Session) LoadJSON(r io.Reader) error {
+	var entries []*sessionCookie
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return err
+	}
+	session.load(entries)
+	return nil
+}
+
+// SaveNetscape writes the cookies.txt format used by curl and browsers.
+func (session *Session) SaveNetscape(w io.Writer) error {
+	session.mu.Lock()
+	entries := session.liveEntries()
+	session.mu.Unlock()
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "# Netscape HTTP Cookie File")
+	for _, entry := range entries {
+		domain := entry.Domain
+		if !entry.HostOnly {
+			domain = "." + domain
+		}
+		if entry.HttpOnly {
+			domain = "#HttpOnly_" + domain
+		}
+		var expires int64
+		if entry.Persistent {
+			expires = entry.Expires.Unix()
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, netscapeBool(!entry.HostOnly), entry.Path, netscapeBool(entry.Secure), expires, entry.Name, entry.Value)
+	}
+	return out.Flush()
+}
+
+func (session *Session) LoadNetscape(r io.Reader) error {
+	var entries []*sessionCookie
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(text, "#HttpOnly_")
+		if httpOnly {
+			text = strings.TrimPrefix(text, "#HttpOnly_")
+		}
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) != 7 {
+			return fmt.Errorf("cookie file line %d: expected 7 fields, got %d", line, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("cookie file line %d: %w", line, err)
+		}
+		entry := &sessionCookie{
+			Domain:   canonicalHost(strings.TrimPrefix(fields[0], ".")),
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expires > 0 {
+			entry.Persistent, entry.Expires = true, time.Unix(expires, 0)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	session.load(entries)
+	return nil
+}
+
+type CookieFormat int
+
+const (
+	CookieJSON CookieFormat = iota
+	CookieNetscape
+)
+
+// SaveFile writes the session to path, readable by the owner only.
+func (session *Session) SaveFile(path string, format CookieFormat) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if format == CookieNetscape {
+		err = session.SaveNetscape(file)
+	} else {
+		err = session.SaveJSON(file)
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+func (session *Session) LoadFile(path string, format CookieFormat) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if format == CookieNetscape {
+		return session.LoadNetscape(file)
+	}
+	return session.LoadJSON(file)
+}
+
+// liveEntries must be called with the lock held.
+func (session *Session) liveEntries() []*sessionCookie {
+	var entries []*sessionCookie
+	for _, entry := range session.sorted() {
+		if !entry.expired(session.now()) {
+			copied := *entry
+			entries = append(entries, &copied)
+		}
+	}
+	return entries
+}
+
+func (session *Session) load(entries []*sessionCookie) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	now := session.now()
+	for _, entry := range entries {
+		if entry.Name == "" || entry.Domain == "" || entry.expired(now) {
+			continue
+		}
+		if entry.Path == "" {
+			entry.Path = "/"
+		}
+		if entry.Created.IsZero() {
+			entry.Created = now
+		}
+		session.sequence++
+		entry.sequence = session.sequence
+		session.entries[entry.key()] = entry
+	}
+}
+
+func netscapeBool(value bool) string {
+	if value {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func canonicalHost(host string) string {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func domainMatch(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func isPublicSuffix(domain string) bool {
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	return suffix == domain
+}
+
+func pathMatch(requestPath, cookiePath string) bool {
+	if requestPath == cookiePath {
+		return true
+	}
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/'
+}
+
+func defaultCookiePath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
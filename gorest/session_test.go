@@ -0,0 +1,159 @@
+package bunker
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSession(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "abc", Path: "/", HttpOnly: true, MaxAge: 3600})
+			http.SetCookie(w, &http.Cookie{Name: "pref", Value: "dark"})
+		case "/logout":
+			http.SetCookie(w, &http.Cookie{Name: "sid", Path: "/", MaxAge: -1})
+		default:
+			if cookie, err := r.Cookie("sid"); err != nil || cookie.Value != "abc" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}
+	}))
+	defer server.Close()
+	host := canonicalHost(strings.TrimPrefix(server.URL, "http://"))
+
+	t.Run("testSharedAcrossRequesters", func(t *testing.T) {
+		session := NewSession()
+		session.New(server.URL).AddPath("login").Get().Do()
+		response := session.New(server.URL).AddPath("reports").Get().Do().Response
+		if response.StatusCode != http.StatusOK {
+			t.Errorf("invalid status\n\tExpected : %v\n\tActual : %v", http.StatusOK, response.StatusCode)
+		}
+		if cookies := session.DomainCookies(host); len(cookies) != 2 {
+			t.Errorf("invalid cookies\n\tExpected : %v\n\tActual : %v", 2, len(cookies))
+		}
+
+		session.New(server.URL).AddPath("logout").Get().Do()
+		response = session.New(server.URL).AddPath("reports").Get().Do().Response
+		if response.StatusCode != http.StatusUnauthorized {
+			t.Errorf("invalid status\n\tExpected : %v\n\tActual : %v", http.StatusUnauthorized, response.StatusCode)
+		}
+	})
+
+	t.Run("testWithClient", func(t *testing.T) {
+		session := NewSession()
+		client := &http.Client{}
+		session.New(server.URL).SetClient(client).AddPath("login").Get().Do()
+		response := session.New(server.URL).SetClient(client).AddPath("reports").Get().Do().Response
+		if response.StatusCode != http.StatusOK || client.Jar != nil {
+			t.Errorf("session must be used on a copy of the client")
+		}
+	})
+
+	t.Run("testWithoutSession", func(t *testing.T) {
+		New(server.URL).AddPath("login").Get().Do()
+		response := New(server.URL).AddPath("reports").Get().Do().Response
+		if response.StatusCode != http.StatusUnauthorized {
+			t.Errorf("invalid status\n\tExpected : %v\n\tActual : %v", http.StatusUnauthorized, response.StatusCode)
+		}
+	})
+
+	t.Run("testPersistence", func(t *testing.T) {
+		session := NewSession()
+		session.New(server.URL).AddPath("login").Get().Do()
+		dir := t.TempDir()
+		for _, format := range []CookieFormat{CookieJSON, CookieNetscape} {
+			path := filepath.Join(dir, "cookies")
+			if err := session.SaveFile(path, format); err != nil {
+				t.Fatal(err)
+			}
+			loaded := NewSession()
+			if err := loaded.LoadFile(path, format); err != nil {
+				t.Fatal(err)
+			}
+			response := loaded.New(server.URL).AddPath("reports").Get().Do().Response
+			if response.StatusCode != http.StatusOK {
+				t.Errorf("invalid status for format %d\n\tExpected : %v\n\tActual : %v", format, http.StatusOK, response.StatusCode)
+			}
+			cookies := loaded.DomainCookies(host)
+			if len(cookies) != 2 || !cookies[1].HttpOnly || cookies[1].Expires.IsZero() {
+				t.Errorf("invalid loaded cookies for format %d %+v", format, cookies)
+			}
+		}
+	})
+}
+
+func TestSessionRules(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	session := NewSession()
+	session.now = func() time.Time { return now }
+	shop, _ := url.Parse("https://www.shop.example.com/cart/items")
+
+	session.SetCookies(shop, []*http.Cookie{
+		{Name: "shared", Value: "1", Domain: ".example.com"},
+		{Name: "host", Value: "2"},
+		{Name: "secure", Value: "3", Secure: true, Path: "/"},
+		{Name: "suffix", Value: "4", Domain: "com"},
+		{Name: "foreign", Value: "5", Domain: "other.org"},
+		{Name: "short", Value: "6", Expires: now.Add(time.Minute)},
+	})
+
+	t.Run("testMatching", func(t *testing.T) {
+		names := func(u string) string {
+			parsed, _ := url.Parse(u)
+			var values []string
+			for _, cookie := range session.Cookies(parsed) {
+				values = append(values, cookie.Name)
+			}
+			return strings.Join(values, ",")
+		}
+		cases := map[string]string{
+			"https://www.shop.example.com/cart/items":  "shared,host,short,secure",
+			"http://www.shop.example.com/cart":         "shared,host,short",
+			"https://api.example.com/cart":             "shared",
+			"https://www.shop.example.com/cartography": "secure",
+		}
+		for u, expected := range cases {
+			if actual := names(u); actual != expected {
+				t.Errorf("invalid cookies for %s\n\tExpected : %v\n\tActual : %v", u, expected, actual)
+			}
+		}
+	})
+
+	t.Run("testExpiry", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		if cookies := session.DomainCookies("www.shop.example.com"); len(cookies) != 2 {
+			t.Errorf("invalid cookies\n\tExpected : %v\n\tActual : %v", 2, len(cookies))
+		}
+	})
+
+	t.Run("testNetscapeFormat", func(t *testing.T) {
+		var buffer bytes.Buffer
+		if err := session.SaveNetscape(&buffer); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buffer.String(), ".example.com\tTRUE\t/cart\tFALSE\t0\tshared\t1\n") {
+			t.Errorf("invalid cookie file\n%s", buffer.String())
+		}
+		if err := NewSession().LoadNetscape(strings.NewReader("example.com\tTRUE\n")); err == nil {
+			t.Error("malformed cookie file must fail")
+		}
+	})
+
+	t.Run("testClearDomain", func(t *testing.T) {
+		session.ClearDomain("shop.example.com")
+		if cookies := session.DomainCookies("example.com"); len(cookies) != 1 || cookies[0].Name != "shared" {
+			t.Errorf("invalid cookies after clear %+v", cookies)
+		}
+		session.Clear()
+		if cookies := session.DomainCookies("example.com"); len(cookies) != 0 {
+			t.Errorf("invalid cookies after clear all %+v", cookies)
+		}
+	})
+}
@@ -0,0 +1,270 @@
+package bunker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yudhiana/bunker"
+)
+
+const EventStream string = "text/event-stream"
+
+// DefaultSSERetry is the reconnection delay until the server sends a retry field.
+const DefaultSSERetry = 3 * time.Second
+
+// Event is a server-sent event.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// EventSource reads a text/event-stream and reconnects with Last-Event-ID when
+// the stream ends, as described by the WHATWG HTML specification. The requester
+// should not have a timeout since the stream is expected to stay open.
+type EventSource struct {
+	requester     *Requester
+	lastEventID   string
+	retry         time.Duration
+	maxReconnects int
+}
+
+func (base *Requester) EventSource() *EventSource {
+	if bunker.IsEmptyString(base.Method) {
+		base.Get()
+	}
+	return &EventSource{requester: base, retry: DefaultSSERetry}
+}
+
+// SetRetry sets the delay before reconnecting, the server may override it.
+func (es *EventSource) SetRetry(retry time.Duration) *EventSource {
+	es.retry = retry
+	return es
+}
+
+// SetLastEventID resumes a stream from an event seen by an earlier process.
+func (es *EventSource) SetLastEventID(id string) *EventSource {
+	es.lastEventID = id
+	return es
+}
+
+// SetMaxReconnects limits consecutive failed reconnects, 0 means no limit.
+func (es *EventSource) SetMaxReconnects(max int) *EventSource {
+	es.maxReconnects = max
+	return es
+}
+
+func (es *EventSource) LastEventID() string {
+	return es.lastEventID
+}
+
+func (es *EventSource) Retry() time.Duration {
+	return es.retry
+}
+
+// errStreamClosed tells Subscribe that the server ended the stream for good.
+var errStreamClosed = errors.New("event stream closed by server")
+
+type fatalStreamError struct {
+	err error
+}
+
+func (e *fatalStreamError) Error() string { return e.err.Error() }
+
+func (e *fatalStreamError) Unwrap() error { return e.err }
+
+// Subscribe calls handler for every event until ctx is done, the handler
+// returns an error or the server answers 204 No Content.
+func (es *EventSource) Subscribe(ctx context.Context, handler func(Event) error) error {
+	if es.requester.HaveError() {
+		return fmt.Errorf("%v", es.requester.Errors)
+	}
+	failures := 0
+	for {
+		received, err := es.connect(ctx, handler)
+		if errors.Is(err, errStreamClosed) {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var fatal *fatalStreamError
+		if errors.As(err, &fatal) {
+			return fatal.err
+		}
+		if received {
+			failures = 0
+		} else {
+			failures++
+		}
+		if es.maxReconnects > 0 && failures > es.maxReconnects {
+			return err
+		}
+
+		timer := time.NewTimer(es.retry)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Events delivers events over a channel, the error channel receives the
+// result of Subscribe once the events channel is closed.
+func (es *EventSource) Events(ctx context.Context) (<-chan Event, <-chan error) {
+	events := make(chan Event)
+	result := make(chan error, 1)
+	go func() {
+		defer close(result)
+		defer close(events)
+		result <- es.Subscribe(ctx, func(event Event) error {
+			select {
+			case events <- event:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return events, result
+}
+
+func (es *EventSource) connect(ctx context.Context, handler func(Event) error) (bool, error) {
+	req := es.requester
+	req.SetContext(ctx).SetHeader("Accept", EventStream).SetHeader("Cache-Control", "no-cache")
+	if es.lastEventID != "" {
+		req.SetHeader("Last-Event-ID", es.lastEventID)
+	} else {
+		delete(req.Header, "Last-Event-ID")
+	}
+	if req.Do().HaveError() {
+		return false, req.Errors[len(req.Errors)-1]
+	}
+	body := req.Response.Body
+	defer body.Close()
+
+	switch {
+	case req.Response.StatusCode == http.StatusNoContent:
+		return false, errStreamClosed
+	case req.Response.StatusCode != http.StatusOK:
+		return false, &fatalStreamError{fmt.Errorf("event stream responded %s", req.Response.Status)}
+	case normalizeMediaType(req.Response.Header.Get("Content-Type")) != EventStream:
+		return false, &fatalStreamError{fmt.Errorf("event stream responded with content type %q", req.Response.Header.Get("Content-Type"))}
+	}
+
+	received := false
+	err := es.parse(body, func(event Event) error {
+		received = true
+		if errHandler := handler(event); errHandler != nil {
+			return &fatalStreamError{errHandler}
+		}
+		return nil
+	})
+	if err == nil {
+		err = io.EOF
+	}
+	return received, err
+}
+
+// parse reads the stream until it ends, dispatching complete events only.
+func (es *EventSource) parse(stream io.Reader, dispatch func(Event) error) error {
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 4096), 1<<20)
+	scanner.Split(scanEventLines)
+
+	var data strings.Builder
+	eventType := ""
+	first := true
+	for scanner.Scan() {
+		line := scanner.Text()
+		if first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			first = false
+		}
+
+		if line == "" {
+			if data.Len() == 0 {
+				eventType = ""
+				continue
+			}
+			event := Event{ID: es.lastEventID, Event: eventType, Data: strings.TrimSuffix(data.String(), "\n")}
+			if event.Event == "" {
+				event.Event = "message"
+			}
+			data.Reset()
+			eventType = ""
+			if err := dispatch(event); err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				es.lastEventID = value
+			}
+		case "retry":
+			if milliseconds, err := strconv.ParseUint(value, 10, 63); err == nil && isDigits(value) {
+				es.retry = time.Duration(milliseconds) * time.Millisecond
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return value != ""
+}
+
+// scanEventLines splits on CRLF, LF or a lone CR.
+func scanEventLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\r' {
+			if i+1 < len(data) {
+				if data[i+1] == '\n' {
+					return i + 2, data[:i], nil
+				}
+				return i + 1, data[:i], nil
+			}
+			if !atEOF {
+				// wait for the next byte to know if this is CRLF
+				return 0, nil, nil
+			}
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		// an unterminated last line never completes an event
+		return len(data), nil, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,88 @@
+package bunker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventSource(t *testing.T) {
+	var connections int32
+	var lastEventIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		switch atomic.AddInt32(&connections, 1) {
+		case 1:
+			w.Header().Set("Content-Type", EventStream)
+			_, _ = io.WriteString(w, "\ufeff: comment\nretry: 5\n\nid: 1\nevent: progress\ndata: first\ndata:  second\n\n")
+			_, _ = io.WriteString(w, "data: crlf\r\n\r\nid: 2\ndata: cut")
+		case 2:
+			w.Header().Set("Content-Type", EventStream+"; charset=utf-8")
+			_, _ = io.WriteString(w, "data: resumed\r\r")
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("testSubscribe", func(t *testing.T) {
+		var events []Event
+		source := New(server.URL).EventSource().SetRetry(time.Hour)
+		err := source.Subscribe(context.Background(), func(event Event) error {
+			events = append(events, event)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []Event{
+			{ID: "1", Event: "progress", Data: "first\n second"},
+			{ID: "1", Event: "message", Data: "crlf"},
+			{ID: "2", Event: "message", Data: "resumed"},
+		}
+		if len(events) != len(expected) {
+			t.Fatalf("invalid events\n\tExpected : %v\n\tActual : %v", expected, events)
+		}
+		for i := range expected {
+			if events[i] != expected[i] {
+				t.Errorf("invalid event\n\tExpected : %+v\n\tActual : %+v", expected[i], events[i])
+			}
+		}
+		if source.Retry() != 5*time.Millisecond {
+			t.Errorf("invalid retry %v", source.Retry())
+		}
+		if strings.Join(lastEventIDs, ",") != ",2,2" {
+			t.Errorf("invalid Last-Event-ID headers %q", lastEventIDs)
+		}
+	})
+
+	t.Run("testEventsChannelCancel", func(t *testing.T) {
+		atomic.StoreInt32(&connections, 0)
+		ctx, cancel := context.WithCancel(context.Background())
+		events, result := New(server.URL).EventSource().Events(ctx)
+		first := <-events
+		cancel()
+		for range events {
+		}
+		if first.Event != "progress" || !errors.Is(<-result, context.Canceled) {
+			t.Errorf("invalid channel result %+v", first)
+		}
+	})
+
+	t.Run("testWrongContentType", func(t *testing.T) {
+		plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "data: x\n\n")
+		}))
+		defer plain.Close()
+		if err := New(plain.URL).EventSource().Subscribe(context.Background(), func(Event) error { return nil }); err == nil {
+			t.Error("non event-stream response must fail")
+		}
+	})
+}
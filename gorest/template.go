@@ -0,0 +1,186 @@
+package bunker
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"time"
+)
+
+// Clone returns a deep copy of the requester that can be changed and sent
+// without affecting the original, the value given to SetPayload included. The
+// response, the attempt count and the idempotency key are not copied, the
+// clone is a new logical request. Unexported fields of payload structs and
+// shared objects such as clients, pools and recorders are not copied.
+func (base *Requester) Clone() *Requester {
+	clone := *base
+
+	clone.Header = cloneHeader(base.Header)
+	clone.basicAuth = cloneStrings(base.basicAuth)
+	clone.pathParams = cloneStrings(base.pathParams)
+	clone.FormData = url.Values(cloneHeader(base.FormData))
+	clone.QueryData = url.Values(cloneHeader(base.QueryData))
+	clone.paths = append([]pathPart(nil), base.paths...)
+	clone.propagators = append([]Propagator(nil), base.propagators...)
+	clone.Errors = append([]error(nil), base.Errors...)
+	clone.body = deepCopy(base.body)
+	if base.payload != nil {
+		clone.payload = append([]byte(nil), base.payload...)
+	}
+	if base.idempotency != nil {
+		idempotency := *base.idempotency
+		idempotency.Methods = append([]string(nil), base.idempotency.Methods...)
+		clone.idempotency = &idempotency
+	}
+	clone.webSocketOptions.Protocols = append([]string(nil), base.webSocketOptions.Protocols...)
+
+	clone.Client = nil
+	clone.Request = nil
+	clone.Response = nil
+	clone.redirects = nil
+	clone.endpoint = ""
+	clone.triedEndpoints = nil
+	clone.idempotencyKey = ""
+	clone.attempt = 0
+	clone.attemptErrorsFrom = 0
+	clone.attemptErrorsTo = 0
+	clone.timeRequest = 0
+	clone.timeIn = time.Time{}
+	return &clone
+}
+
+func cloneHeader(header map[string][]string) map[string][]string {
+	if header == nil {
+		return make(map[string][]string)
+	}
+	return http.Header(header).Clone()
+}
+
+func cloneStrings(values map[string]string) map[string]string {
+	clone := make(map[string]string, len(values))
+	for k, v := range values {
+		clone[k] = v
+	}
+	return clone
+}
+
+// deepCopy copies the maps, slices, arrays and pointers of a payload value.
+func deepCopy(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return deepCopyValue(reflect.ValueOf(value)).Interface()
+}
+
+func deepCopyValue(value reflect.Value) reflect.Value {
+	switch value.Kind() {
+	case reflect.Map:
+		if value.IsNil() {
+			return value
+		}
+		copied := reflect.MakeMapWithSize(value.Type(), value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			copied.SetMapIndex(iter.Key(), deepCopyValue(iter.Value()))
+		}
+		return copied
+	case reflect.Slice:
+		if value.IsNil() {
+			return value
+		}
+		copied := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			copied.Index(i).Set(deepCopyValue(value.Index(i)))
+		}
+		return copied
+	case reflect.Array:
+		copied := reflect.New(value.Type()).Elem()
+		for i := 0; i < value.Len(); i++ {
+			copied.Index(i).Set(deepCopyValue(value.Index(i)))
+		}
+		return copied
+	case reflect.Pointer:
+		if value.IsNil() {
+			return value
+		}
+		copied := reflect.New(value.Type().Elem())
+		copied.Elem().Set(deepCopyValue(value.Elem()))
+		return copied
+	case reflect.Interface:
+		if value.IsNil() {
+			return value
+		}
+		copied := reflect.New(value.Type()).Elem()
+		copied.Set(deepCopyValue(value.Elem()))
+		return copied
+	case reflect.Struct:
+		copied := reflect.New(value.Type()).Elem()
+		copied.Set(value)
+		for i := 0; i < value.NumField(); i++ {
+			if copied.Field(i).CanSet() {
+				copied.Field(i).Set(deepCopyValue(value.Field(i)))
+			}
+		}
+		return copied
+	}
+	return value
+}
+
+// Template is a configured requester that is never sent itself. It is safe
+// for concurrent use, every call starts from a deep copy of it.
+type Template struct {
+	base *Requester
+}
+
+// NewTemplate freezes a copy of req, e.g.
+//
+//	api := NewTemplate(New("https://api.example.com").SetToken(token).SetTimeout(5 * time.Second))
+//	user := api.Get("/users/{id}").PathParam("id", id).Do()
+func NewTemplate(req *Requester) *Template {
+	return &Template{base: req.Clone()}
+}
+
+// With returns a new template with opts applied, the receiver is unchanged.
+func (tmpl *Template) With(opts ...Option) *Template {
+	req := tmpl.base.Clone()
+	for _, opt := range opts {
+		req = opt(req)
+	}
+	return &Template{base: req}
+}
+
+// New returns a requester to configure and send.
+func (tmpl *Template) New() *Requester {
+	return tmpl.base.Clone()
+}
+
+func (tmpl *Template) request(method, path string) *Requester {
+	req := tmpl.New()
+	req.Method = method
+	if path != "" {
+		req.paths = append(req.paths, pathPart{value: path, template: true})
+	}
+	return req
+}
+
+// Get starts a GET request, path is a template as accepted by SetPath and is
+// joined to the paths of the template.
+func (tmpl *Template) Get(path string) *Requester {
+	return tmpl.request(GET, path)
+}
+
+func (tmpl *Template) Post(path string) *Requester {
+	return tmpl.request(POST, path)
+}
+
+func (tmpl *Template) Put(path string) *Requester {
+	return tmpl.request(PUT, path)
+}
+
+func (tmpl *Template) Patch(path string) *Requester {
+	return tmpl.request(PATCH, path)
+}
+
+func (tmpl *Template) Delete(path string) *Requester {
+	return tmpl.request(DELETE, path)
+}
@@ -0,0 +1,87 @@
+package bunker
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(Auth) != Bearer+"secret" || r.Header.Get("X-Call") != r.URL.Query().Get("call") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("X-Path", r.URL.Path)
+	}))
+	defer server.Close()
+
+	headers := map[string][]string{"X-App-Origin": {"xman"}}
+	api := NewTemplate(New(server.URL).SetToken("secret").SetHeaders(headers).AddPath("/v1"))
+	headers["X-App-Origin"][0] = "changed"
+
+	t.Run("testConcurrentUse", func(t *testing.T) {
+		var wg sync.WaitGroup
+		failures := make(chan string, 50)
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				call := fmt.Sprint(i)
+				req := api.Get("/users/{id}").PathParam("id", call).SetHeader("X-Call", call).Query(map[string]string{"call": call}).Do()
+				if req.HaveError() || req.Response.StatusCode != http.StatusOK || req.Response.Header.Get("X-Path") != "/v1/users/"+call {
+					failures <- call
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(failures)
+		for call := range failures {
+			t.Errorf("invalid response for call %s", call)
+		}
+	})
+
+	t.Run("testTemplateUnchanged", func(t *testing.T) {
+		derived := api.With(WithHeader("X-Extra", "1"))
+		req := api.New().SetHeader("X-Call", "1").Query("a=b")
+		req.Header["X-App-Origin"][0] = "mutated"
+
+		fresh := api.New()
+		if _, found := fresh.Header["X-Call"]; found || len(fresh.QueryData) != 0 {
+			t.Error("template must not see changes of its requesters")
+		}
+		if fresh.Header["X-App-Origin"][0] != "xman" {
+			t.Errorf("invalid template header %v", fresh.Header["X-App-Origin"])
+		}
+		if _, found := fresh.Header["X-Extra"]; found || derived.New().Header["X-Extra"] == nil {
+			t.Error("With must derive a new template")
+		}
+	})
+
+	t.Run("testCloneIsIndependent", func(t *testing.T) {
+		original := New(server.URL).Post().SetIdempotency(Idempotency{}).SetPayload("a")
+		original.Do()
+		clone := original.Clone()
+		if clone.Response != nil || clone.IdempotencyKey() != "" || original.IdempotencyKey() == "" {
+			t.Error("clone must start a new logical request")
+		}
+	})
+
+	t.Run("testClonePayloadIsIndependent", func(t *testing.T) {
+		type order struct {
+			Items []string `json:"items"`
+		}
+		payload := map[string]interface{}{"order": &order{Items: []string{"a"}}, "tags": []interface{}{"x"}}
+		original := New(server.URL).Post().SetPayload(payload)
+		clone := original.Clone()
+		clone.body.(map[string]interface{})["order"].(*order).Items[0] = "b"
+		clone.body.(map[string]interface{})["tags"].([]interface{})[0] = "y"
+		clone.body.(map[string]interface{})["added"] = true
+
+		if payload["order"].(*order).Items[0] != "a" || payload["tags"].([]interface{})[0] != "x" || len(payload) != 2 {
+			t.Errorf("changing the clone payload must not change the original %v", payload)
+		}
+	})
+}
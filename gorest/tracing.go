@@ -0,0 +1,338 @@
+package bunker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TraceParentHeader string = "traceparent"
+	TraceStateHeader  string = "tracestate"
+)
+
+// SpanContext identifies a span as described by W3C Trace Context.
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Sampled    bool
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+func (sc SpanContext) TraceIDString() string {
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+func (sc SpanContext) SpanIDString() string {
+	return hex.EncodeToString(sc.SpanID[:])
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext stores the span that outgoing requests are children of.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	if ctx == nil {
+		return SpanContext{}, false
+	}
+	sc, found := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, found && sc.IsValid()
+}
+
+// ExtractTraceContext reads traceparent and tracestate from incoming headers.
+func ExtractTraceContext(header http.Header) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header.Get(TraceParentHeader)), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+	sc.TraceState = header.Get(TraceStateHeader)
+	return sc, true
+}
+
+// Propagator writes a span context into outgoing request headers.
+type Propagator interface {
+	Inject(sc SpanContext, header http.Header)
+}
+
+// W3CTraceContext injects the traceparent and tracestate headers.
+type W3CTraceContext struct{}
+
+func (W3CTraceContext) Inject(sc SpanContext, header http.Header) {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	header.Set(TraceParentHeader, "00-"+sc.TraceIDString()+"-"+sc.SpanIDString()+"-"+flags)
+	if sc.TraceState != "" {
+		header.Set(TraceStateHeader, sc.TraceState)
+	}
+}
+
+// B3 injects Zipkin B3 headers, either the single b3 header or the X-B3-* set.
+type B3 struct {
+	SingleHeader bool
+}
+
+func (b3 B3) Inject(sc SpanContext, header http.Header) {
+	sampled := "0"
+	if sc.Sampled {
+		sampled = "1"
+	}
+	if b3.SingleHeader {
+		header.Set("b3", sc.TraceIDString()+"-"+sc.SpanIDString()+"-"+sampled)
+		return
+	}
+	header.Set("X-B3-TraceId", sc.TraceIDString())
+	header.Set("X-B3-SpanId", sc.SpanIDString())
+	header.Set("X-B3-Sampled", sampled)
+}
+
+type SpanStatus int
+
+const (
+	SpanStatusUnset SpanStatus = iota
+	SpanStatusOk
+	SpanStatusError
+)
+
+// Span is the part of an OpenTelemetry span the requester needs, an adapter
+// for the OpenTelemetry SDK only has to forward these calls.
+type Span interface {
+	SpanContext() SpanContext
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	SetStatus(status SpanStatus, description string)
+	End()
+}
+
+// Tracer starts a client span for every attempt made by Do.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+func (base *Requester) SetTracer(tracer Tracer) *Requester {
+	base.tracer = tracer
+	return base
+}
+
+// SetPropagation replaces the default W3C propagation, e.g. to also send B3.
+func (base *Requester) SetPropagation(propagators ...Propagator) *Requester {
+	base.propagators = propagators
+	return base
+}
+
+func (base *Requester) startSpan() Span {
+	ctx := base.Request.Context()
+	var span Span
+	if base.tracer != nil {
+		name := base.Method
+		route, templated := base.pathTemplate()
+		if templated {
+			name += " " + route
+		}
+		ctx, span = base.tracer.Start(ctx, name)
+		base.Request = base.Request.WithContext(ctx)
+		if templated {
+			span.SetAttribute("url.template", route)
+		}
+		span.SetAttribute("http.request.method", base.Method)
+		span.SetAttribute("url.full", redactedURL(base.Request))
+		span.SetAttribute("server.address", base.Request.URL.Hostname())
+		if port := requestPort(base.Request); port != 0 {
+			span.SetAttribute("server.port", port)
+		}
+		if base.attempt > 1 {
+			span.SetAttribute("http.request.resend_count", base.attempt-1)
+		}
+	}
+
+	sc, found := SpanContextFromContext(ctx)
+	if span != nil {
+		sc, found = span.SpanContext(), span.SpanContext().IsValid()
+	}
+	if found {
+		propagators := base.propagators
+		if propagators == nil {
+			propagators = []Propagator{W3CTraceContext{}}
+		}
+		for _, propagator := range propagators {
+			propagator.Inject(sc, base.Request.Header)
+		}
+	}
+	return span
+}
+
+func (base *Requester) endSpan(span Span, response *http.Response, err error) {
+	if span == nil {
+		return
+	}
+	defer span.End()
+	if err != nil {
+		span.SetAttribute("error.type", errorType(err))
+		span.RecordError(err)
+		span.SetStatus(SpanStatusError, err.Error())
+		return
+	}
+	span.SetAttribute("http.response.status_code", response.StatusCode)
+	if response.StatusCode >= http.StatusBadRequest {
+		span.SetAttribute("error.type", strconv.Itoa(response.StatusCode))
+		span.SetStatus(SpanStatusError, response.Status)
+	}
+}
+
+func redactedURL(request *http.Request) string {
+	if request.URL.User == nil {
+		return request.URL.String()
+	}
+	clean := *request.URL
+	clean.User = nil
+	return clean.String()
+}
+
+func requestPort(request *http.Request) int {
+	if port := request.URL.Port(); port != "" {
+		number, _ := strconv.Atoi(port)
+		return number
+	}
+	switch request.URL.Scheme {
+	case "https":
+		return 443
+	case "http":
+		return 80
+	}
+	return 0
+}
+
+func errorType(err error) string {
+	if netErr, isNetErr := err.(net.Error); isNetErr && netErr.Timeout() {
+		return "timeout"
+	}
+	return "_OTHER"
+}
+
+// RecordedSpan is a finished span kept by MemoryTracer.
+type RecordedSpan struct {
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanContext
+	Attributes  map[string]interface{}
+	Errors      []error
+	Status      SpanStatus
+	Description string
+	Start       time.Time
+	End         time.Time
+}
+
+// MemoryTracer records spans in memory, it is meant for tests and does not
+// need a collector.
+type MemoryTracer struct {
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+func NewMemoryTracer() *MemoryTracer {
+	return &MemoryTracer{}
+}
+
+func (tracer *MemoryTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &memorySpan{
+		tracer: tracer,
+		record: RecordedSpan{Name: name, Attributes: make(map[string]interface{}), Start: time.Now()},
+	}
+	parent, hasParent := SpanContextFromContext(ctx)
+	if hasParent {
+		span.record.Parent = parent
+		span.record.SpanContext.TraceID = parent.TraceID
+		span.record.SpanContext.Sampled = parent.Sampled
+		span.record.SpanContext.TraceState = parent.TraceState
+	} else {
+		_, _ = rand.Read(span.record.SpanContext.TraceID[:])
+		span.record.SpanContext.Sampled = true
+	}
+	_, _ = rand.Read(span.record.SpanContext.SpanID[:])
+	return ContextWithSpanContext(ctx, span.record.SpanContext), span
+}
+
+// Spans returns the spans ended so far.
+func (tracer *MemoryTracer) Spans() []RecordedSpan {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	return append([]RecordedSpan(nil), tracer.spans...)
+}
+
+func (tracer *MemoryTracer) Reset() {
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	tracer.spans = nil
+}
+
+type memorySpan struct {
+	tracer *MemoryTracer
+	mu     sync.Mutex
+	record RecordedSpan
+	ended  bool
+}
+
+func (span *memorySpan) SpanContext() SpanContext {
+	return span.record.SpanContext
+}
+
+func (span *memorySpan) SetAttribute(key string, value interface{}) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	span.record.Attributes[key] = value
+}
+
+func (span *memorySpan) RecordError(err error) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	span.record.Errors = append(span.record.Errors, err)
+}
+
+func (span *memorySpan) SetStatus(status SpanStatus, description string) {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	span.record.Status = status
+	span.record.Description = description
+}
+
+func (span *memorySpan) End() {
+	span.mu.Lock()
+	if span.ended {
+		span.mu.Unlock()
+		return
+	}
+	span.ended = true
+	span.record.End = time.Now()
+	record := span.record
+	span.mu.Unlock()
+
+	span.tracer.mu.Lock()
+	defer span.tracer.mu.Unlock()
+	span.tracer.spans = append(span.tracer.spans, record)
+}
@@ -0,0 +1,86 @@
+package bunker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	incoming := http.Header{}
+	incoming.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	incoming.Set(TraceStateHeader, "vendor=value")
+	parent, found := ExtractTraceContext(incoming)
+	if !found {
+		t.Fatal("traceparent must be extracted")
+	}
+	ctx := ContextWithSpanContext(context.Background(), parent)
+
+	t.Run("testPropagationWithoutTracer", func(t *testing.T) {
+		New(server.URL).Get().SetContext(ctx).Do()
+		if header.Get(TraceParentHeader) != incoming.Get(TraceParentHeader) {
+			t.Errorf("invalid traceparent\n\tExpected : %v\n\tActual : %v", incoming.Get(TraceParentHeader), header.Get(TraceParentHeader))
+		}
+		if header.Get(TraceStateHeader) != "vendor=value" {
+			t.Errorf("invalid tracestate %v", header.Get(TraceStateHeader))
+		}
+	})
+
+	t.Run("testClientSpan", func(t *testing.T) {
+		tracer := NewMemoryTracer()
+		New(server.URL).Get().AddPath("/missing").SetContext(ctx).SetTracer(tracer).
+			SetPropagation(W3CTraceContext{}, B3{}).Do()
+
+		spans := tracer.Spans()
+		if len(spans) != 1 {
+			t.Fatalf("invalid spans count %d", len(spans))
+		}
+		span := spans[0]
+		if span.Parent.SpanID != parent.SpanID || span.SpanContext.TraceID != parent.TraceID {
+			t.Error("span must be a child of the context span")
+		}
+		forwarded, _ := ExtractTraceContext(header)
+		if forwarded.SpanID != span.SpanContext.SpanID {
+			t.Errorf("invalid forwarded span\n\tExpected : %v\n\tActual : %v", span.SpanContext.SpanIDString(), forwarded.SpanIDString())
+		}
+		if header.Get("X-B3-TraceId") != parent.TraceIDString() {
+			t.Errorf("invalid b3 trace id %v", header.Get("X-B3-TraceId"))
+		}
+		if span.Attributes["http.request.method"] != GET || span.Attributes["http.response.status_code"] != http.StatusNotFound {
+			t.Errorf("invalid attributes %v", span.Attributes)
+		}
+		if span.Status != SpanStatusError {
+			t.Error("4xx response must mark the span as error")
+		}
+	})
+
+	t.Run("testSpanPerAttemptAndError", func(t *testing.T) {
+		tracer := NewMemoryTracer()
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+
+		req := New(closed.URL).Get().SetTracer(tracer)
+		req.Do()
+		req.Do()
+		spans := tracer.Spans()
+		if len(spans) != 2 {
+			t.Fatalf("invalid spans count %d", len(spans))
+		}
+		if len(spans[1].Errors) != 1 || spans[1].Status != SpanStatusError {
+			t.Error("transport error must be recorded")
+		}
+		if spans[1].Attributes["http.request.resend_count"] != 1 {
+			t.Errorf("invalid resend count %v", spans[1].Attributes["http.request.resend_count"])
+		}
+	})
+}
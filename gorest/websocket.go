@@ -0,0 +1,315 @@
+package bunker
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// WebSocketOptions configures Dial. Pings are sent every PingInterval, the
+// pong answers are consumed by golang.org/x/net/websocket itself so a dead
+// peer shows up as a failed ping or as ReadTimeout passing without a message.
+type WebSocketOptions struct {
+	Protocols    []string
+	Origin       string
+	PingInterval time.Duration
+	ReadTimeout  time.Duration
+
+	// Reconnect dials again with exponential backoff when reading or
+	// writing fails, OnReconnect runs after every successful redial. A failed
+	// read is retried on the new connection, a failed message is sent again
+	// only when the broken connection was closed before it was written.
+	Reconnect     bool
+	MaxReconnects int
+	BackoffMin    time.Duration
+	BackoffMax    time.Duration
+	OnReconnect   func(ws *WebSocket) error
+	// ResendOnReconnect sends every failed message again on the new
+	// connection, a message partly or fully written before the failure is
+	// then delivered twice.
+	ResendOnReconnect bool
+}
+
+type MessageType byte
+
+const (
+	TextMessage   MessageType = websocket.TextFrame
+	BinaryMessage MessageType = websocket.BinaryFrame
+	pingMessage   MessageType = websocket.PingFrame
+)
+
+type Message struct {
+	Type MessageType
+	Data []byte
+}
+
+func (message Message) Text() string {
+	return string(message.Data)
+}
+
+var ErrWebSocketClosed = errors.New("websocket closed")
+
+// WebSocket is a client connection that carries the headers, token, basic
+// auth and TLS settings of the requester it was dialed from.
+type WebSocket struct {
+	config  *websocket.Config
+	options WebSocketOptions
+
+	mu     sync.Mutex
+	redial sync.Mutex
+	conn   *websocket.Conn
+	closed bool
+	stop   chan struct{}
+}
+
+func (base *Requester) SetWebSocketOptions(options WebSocketOptions) *Requester {
+	base.webSocketOptions = options
+	return base
+}
+
+// Dial upgrades to a WebSocket, http and https urls become ws and wss. The
+// handshake only carries the url, headers and credentials of the requester.
+func (base *Requester) Dial() (*WebSocket, error) {
+	handshake, err := base.newRequest(GET, nil)
+	if err != nil {
+		base.Errors = append(base.Errors, err)
+		return nil, err
+	}
+
+	location := *handshake.URL
+	switch location.Scheme {
+	case "http":
+		location.Scheme = "ws"
+	case "https":
+		location.Scheme = "wss"
+	}
+	origin := base.webSocketOptions.Origin
+	if origin == "" {
+		scheme := "http"
+		if location.Scheme == "wss" {
+			scheme = "https"
+		}
+		origin = scheme + "://" + location.Host
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		base.Errors = append(base.Errors, err)
+		return nil, err
+	}
+
+	header := handshake.Header
+	header.Del("Content-Type")
+	config := &websocket.Config{
+		Location:  &location,
+		Origin:    originURL,
+		Protocol:  base.webSocketOptions.Protocols,
+		Version:   websocket.ProtocolVersionHybi13,
+		TlsConfig: &tls.Config{InsecureSkipVerify: base.insecureSkipVerify},
+		Header:    header,
+		Dialer:    &net.Dialer{Timeout: base.TimeOut},
+	}
+
+	conn, err := websocket.DialConfig(config)
+	if err != nil {
+		base.Errors = append(base.Errors, err)
+		return nil, err
+	}
+	ws := &WebSocket{config: config, options: base.webSocketOptions, conn: conn, stop: make(chan struct{})}
+	if ws.options.PingInterval > 0 {
+		go ws.keepAlive()
+	}
+	return ws, nil
+}
+
+func (ws *WebSocket) current() (*websocket.Conn, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return nil, ErrWebSocketClosed
+	}
+	return ws.conn, nil
+}
+
+func (ws *WebSocket) SendText(text string) error {
+	return ws.send(TextMessage, []byte(text))
+}
+
+func (ws *WebSocket) SendBinary(data []byte) error {
+	return ws.send(BinaryMessage, data)
+}
+
+func (ws *WebSocket) SendJSON(v interface{}) error {
+	data, err := JSONCodec{}.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.send(TextMessage, data)
+}
+
+// Receive blocks until the next text or binary message.
+func (ws *WebSocket) Receive() (Message, error) {
+	var message Message
+	err := ws.withReconnect(func(conn *websocket.Conn) error {
+		if ws.options.ReadTimeout > 0 {
+			if err := conn.SetReadDeadline(time.Now().Add(ws.options.ReadTimeout)); err != nil {
+				return err
+			}
+		}
+		return frameCodec.Receive(conn, &message)
+	}, func(error) bool { return true })
+	return message, err
+}
+
+func (ws *WebSocket) ReceiveJSON(v interface{}) error {
+	message, err := ws.Receive()
+	if err != nil {
+		return err
+	}
+	return JSONCodec{}.Unmarshal(message.Data, v)
+}
+
+func (ws *WebSocket) Close() error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.closed {
+		return nil
+	}
+	ws.closed = true
+	close(ws.stop)
+	return ws.conn.Close()
+}
+
+func (ws *WebSocket) send(messageType MessageType, data []byte) error {
+	return ws.withReconnect(func(conn *websocket.Conn) error {
+		return frameCodec.Send(conn, Message{Type: messageType, Data: data})
+	}, ws.resend)
+}
+
+// resend tells whether a message that failed with err is sent again, nothing
+// is written on a connection that was already closed.
+func (ws *WebSocket) resend(err error) bool {
+	return ws.options.ResendOnReconnect || errors.Is(err, net.ErrClosed)
+}
+
+// frameCodec keeps the frame type of a message, it also lets keepAlive send
+// ping frames which x/net/websocket has no method for.
+var frameCodec = websocket.Codec{
+	Marshal: func(v interface{}) ([]byte, byte, error) {
+		message := v.(Message)
+		return message.Data, byte(message.Type), nil
+	},
+	Unmarshal: func(data []byte, payloadType byte, v interface{}) error {
+		*v.(*Message) = Message{Type: MessageType(payloadType), Data: data}
+		return nil
+	},
+}
+
+func (ws *WebSocket) keepAlive() {
+	ticker := time.NewTicker(ws.options.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ws.stop:
+			return
+		case <-ticker.C:
+			conn, err := ws.current()
+			if err != nil {
+				return
+			}
+			if err := frameCodec.Send(conn, Message{Type: pingMessage}); err != nil {
+				// the reader notices the broken connection and reconnects
+				_ = conn.Close()
+			}
+		}
+	}
+}
+
+// withReconnect runs operation again on the new connection when retry
+// accepts its error.
+func (ws *WebSocket) withReconnect(operation func(conn *websocket.Conn) error, retry func(err error) bool) error {
+	conn, err := ws.current()
+	if err != nil {
+		return err
+	}
+	err = operation(conn)
+	if err == nil || !ws.options.Reconnect {
+		return err
+	}
+	redialed, errReconnect := ws.reconnect(conn)
+	if errReconnect != nil {
+		return errReconnect
+	}
+	// OnReconnect runs without the redial lock so it can send and reconnect
+	if redialed && ws.options.OnReconnect != nil {
+		if errCallback := ws.options.OnReconnect(ws); errCallback != nil {
+			return errCallback
+		}
+	}
+	if !retry(err) {
+		return err
+	}
+	conn, err = ws.current()
+	if err != nil {
+		return err
+	}
+	return operation(conn)
+}
+
+// reconnect replaces a broken connection and reports whether it dialed,
+// concurrent callers that saw the same broken connection only dial once.
+func (ws *WebSocket) reconnect(broken *websocket.Conn) (bool, error) {
+	ws.redial.Lock()
+	defer ws.redial.Unlock()
+	ws.mu.Lock()
+	if ws.closed {
+		ws.mu.Unlock()
+		return false, ErrWebSocketClosed
+	}
+	if ws.conn != broken {
+		ws.mu.Unlock()
+		return false, nil
+	}
+	_ = broken.Close()
+	ws.mu.Unlock()
+
+	delay := ws.options.BackoffMin
+	if delay <= 0 {
+		delay = 100 * time.Millisecond
+	}
+	maxDelay := ws.options.BackoffMax
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+	var err error
+	for attempt := 1; ws.options.MaxReconnects <= 0 || attempt <= ws.options.MaxReconnects; attempt++ {
+		var conn *websocket.Conn
+		conn, err = websocket.DialConfig(ws.config)
+		if err == nil {
+			ws.mu.Lock()
+			if ws.closed {
+				ws.mu.Unlock()
+				_ = conn.Close()
+				return false, ErrWebSocketClosed
+			}
+			ws.conn = conn
+			ws.mu.Unlock()
+			return true, nil
+		}
+
+		select {
+		case <-ws.stop:
+			return false, ErrWebSocketClosed
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+	return false, err
+}
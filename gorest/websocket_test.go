@@ -0,0 +1,189 @@
+package bunker
+
+import (
+	"errors"
+	"net"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestWebSocket(t *testing.T) {
+	var connections int32
+	handshakes := make(chan [2]string, 8)
+	server := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		handshakes <- [2]string{conn.Request().Header.Get(Auth), conn.Request().Header.Get("X-App-Origin")}
+		if atomic.AddInt32(&connections, 1) == 2 {
+			// a broken connection the client has to redial
+			conn.Close()
+			return
+		}
+		for {
+			var message Message
+			if err := frameCodec.Receive(conn, &message); err != nil {
+				return
+			}
+			if err := frameCodec.Send(conn, message); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	t.Run("testEcho", func(t *testing.T) {
+		ws, err := New(server.URL).SetToken("secret").SetHeader("X-App-Origin", "xman").
+			SetWebSocketOptions(WebSocketOptions{PingInterval: 10 * time.Millisecond}).Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+		if headers := <-handshakes; headers[0] != Bearer+"secret" || headers[1] != "xman" {
+			t.Errorf("invalid handshake headers %q", headers)
+		}
+
+		if err := ws.SendText("hello"); err != nil {
+			t.Fatal(err)
+		}
+		message, err := ws.Receive()
+		if err != nil || message.Type != TextMessage || message.Text() != "hello" {
+			t.Errorf("invalid text message %+v %v", message, err)
+		}
+
+		time.Sleep(30 * time.Millisecond)
+		if err := ws.SendBinary([]byte{1, 2}); err != nil {
+			t.Fatal(err)
+		}
+		message, err = ws.Receive()
+		if err != nil || message.Type != BinaryMessage || len(message.Data) != 2 {
+			t.Errorf("invalid binary message %+v %v", message, err)
+		}
+
+		var payload map[string]int
+		if err := ws.SendJSON(map[string]int{"id": 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := ws.ReceiveJSON(&payload); err != nil || payload["id"] != 1 {
+			t.Errorf("invalid json message %v %v", payload, err)
+		}
+	})
+
+	t.Run("testReconnect", func(t *testing.T) {
+		reconnected := 0
+		ws, err := New(server.URL).SetWebSocketOptions(WebSocketOptions{
+			Reconnect:  true,
+			BackoffMin: time.Millisecond,
+			OnReconnect: func(ws *WebSocket) error {
+				reconnected++
+				return ws.SendText("again")
+			},
+		}).Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		message, err := ws.Receive()
+		if err != nil || message.Text() != "again" || reconnected != 1 {
+			t.Errorf("invalid reconnect %+v %v %d", message, err, reconnected)
+		}
+	})
+
+	t.Run("testResend", func(t *testing.T) {
+		req := New(server.URL).Post().SetPayload(map[string]string{"a": "b"}).
+			SetWebSocketOptions(WebSocketOptions{Reconnect: true, BackoffMin: time.Millisecond})
+		ws, err := req.Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+		if req.Request != nil {
+			t.Errorf("dial must not build the request of Do")
+		}
+
+		conn, _ := ws.current()
+		_ = conn.Close()
+		if err := ws.SendText("after close"); err != nil {
+			t.Fatal(err)
+		}
+		if message, err := ws.Receive(); err != nil || message.Text() != "after close" {
+			t.Errorf("invalid resent message %+v %v", message, err)
+		}
+
+		if ws.resend(errors.New("broken pipe")) {
+			t.Errorf("a message that may have been written must not be sent again")
+		}
+		if !ws.resend(&net.OpError{Op: "write", Err: net.ErrClosed}) {
+			t.Errorf("a message never written must be sent again")
+		}
+	})
+
+	t.Run("testOnReconnectSendFails", func(t *testing.T) {
+		echo := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+			for {
+				var message Message
+				if err := frameCodec.Receive(conn, &message); err != nil {
+					return
+				}
+				if err := frameCodec.Send(conn, message); err != nil {
+					return
+				}
+			}
+		}))
+		defer echo.Close()
+
+		reconnected := 0
+		ws, err := New(echo.URL).SetWebSocketOptions(WebSocketOptions{
+			Reconnect:  true,
+			BackoffMin: time.Millisecond,
+			OnReconnect: func(ws *WebSocket) error {
+				reconnected++
+				if reconnected == 1 {
+					conn, _ := ws.current()
+					_ = conn.Close()
+				}
+				return ws.SendText("again")
+			},
+		}).Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ws.Close()
+
+		conn, _ := ws.current()
+		_ = conn.Close()
+		sent := make(chan error, 1)
+		go func() {
+			sent <- ws.SendText("hello")
+		}()
+		select {
+		case err := <-sent:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("a failed send in OnReconnect must not deadlock")
+		}
+		for _, expected := range []string{"again", "again", "hello"} {
+			if message, err := ws.Receive(); err != nil || message.Text() != expected {
+				t.Errorf("invalid message\n\tExpected : %v\n\tActual : %v %v", expected, message.Text(), err)
+			}
+		}
+		if reconnected != 2 {
+			t.Errorf("invalid reconnects\n\tExpected : %v\n\tActual : %v", 2, reconnected)
+		}
+	})
+
+	t.Run("testClosed", func(t *testing.T) {
+		ws, err := New(server.URL).Dial()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ws.Close()
+		if err := ws.SendText("late"); err != ErrWebSocketClosed {
+			t.Errorf("invalid error after close %v", err)
+		}
+	})
+}